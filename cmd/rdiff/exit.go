@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+
+	"github.com/Psykepro/rdiff/pkg/differ"
+	"github.com/Psykepro/rdiff/pkg/fileio"
+	"github.com/Psykepro/rdiff/pkg/format/librsync"
+	"github.com/Psykepro/rdiff/pkg/hash"
+)
+
+// Exit codes, so that scripts can tell the failures apart
+const (
+	exitFailure  = 1 // Any failure not listed below
+	exitUsage    = 2 // Invalid arguments, the same code the flag package exits with
+	exitRead     = 3 // An input file cannot be opened or read
+	exitWrite    = 4 // An output file cannot be created or written
+	exitDecode   = 5 // A signature or delta file is invalid
+	exitChecksum = 6 // The patched file does not match the checksum stored in the delta
+	exitBasis    = 7 // The original file given to patch is not the one the delta was generated against
+	exitCanceled = 130
+)
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		// The shell reports a process killed by SIGINT the same way
+		return exitCanceled
+	case errors.Is(err, hash.ErrUnknownWeakHash), errors.Is(err, hash.ErrUnknownStrongHash):
+		return exitUsage
+	case errors.Is(err, fileio.ErrChecksumMismatch):
+		return exitChecksum
+	case errors.Is(err, fileio.ErrBasisMismatch):
+		return exitBasis
+	case errors.Is(err, fileio.ErrDecodeSignatures), errors.Is(err, fileio.ErrDecodeDelta), errors.Is(err, differ.ErrInvalidOp),
+		errors.Is(err, librsync.ErrDecodeSignatures), errors.Is(err, librsync.ErrDecodeDelta):
+		return exitDecode
+	case errors.Is(err, fileio.ErrReadFile), errors.Is(err, differ.ErrReadOriginal), errors.Is(err, differ.ErrReadUpdated):
+		return exitRead
+	case errors.Is(err, fileio.ErrCreateFile), errors.Is(err, fileio.ErrWriteFile),
+		errors.Is(err, fileio.ErrEncodeSignatures), errors.Is(err, fileio.ErrEncodeDelta),
+		errors.Is(err, librsync.ErrEncodeSignatures), errors.Is(err, librsync.ErrEncodeDelta):
+		return exitWrite
+	default:
+		return exitFailure
+	}
+}
+
+// Removes the unfinished files and exits with the code matching err.
+func fatal(err error) {
+	for _, path := range unfinishedFiles {
+		os.Remove(path)
+	}
+	log.Print(err)
+	os.Exit(exitCode(err))
+}
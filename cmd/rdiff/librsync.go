@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+
+	"github.com/Psykepro/rdiff/pkg/differ"
+	"github.com/Psykepro/rdiff/pkg/fileio"
+	"github.com/Psykepro/rdiff/pkg/format/librsync"
+)
+
+// Formats of the signature and delta files
+const (
+	formatRdiff    = "rdiff"
+	formatLibrsync = "librsync"
+)
+
+func validFormat(format string) bool {
+	return format == formatRdiff || format == formatLibrsync
+}
+
+func readLibrsyncSignatures(ctx context.Context, signatureFile string) (*differ.SignatureTable, error) {
+	file, err := fileio.OpenFile(signatureFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := fileio.NewContextReader(ctx, file)
+	signatures, err := librsync.DecodeSignatures(reader)
+	if err != nil {
+		return nil, reader.Cause(err)
+	}
+	return signatures, nil
+}
+
+func applyLibrsyncDelta(ctx context.Context, basisFile, deltaFile, output string) {
+	delta, err := fileio.OpenFile(deltaFile)
+	if err != nil {
+		fatal(err)
+	}
+	defer delta.Close()
+
+	basis, closeBasis, err := openBasis(basisFile)
+	if err != nil {
+		fatal(err)
+	}
+	defer closeBasis()
+
+	// The updated file only replaces output once it is complete
+	updated, err := createRenamedOutput(output)
+	if err != nil {
+		fatal(err)
+	}
+
+	input := fileio.NewContextReader(ctx, delta)
+	if err := librsync.Patch(basis, input, fileio.NewContextWriter(ctx, updated)); err != nil {
+		fatal(input.Cause(err))
+	}
+	if err := updated.Close(); err != nil {
+		fatal(err)
+	}
+
+	info("Delta applied and updated file saved to: %s", displayPath(output))
+}
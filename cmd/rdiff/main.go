@@ -1,54 +1,165 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"math"
 	"os"
+	"runtime"
+	"strconv"
 
 	"github.com/Psykepro/rdiff/pkg/differ"
 	"github.com/Psykepro/rdiff/pkg/fileio"
+	"github.com/Psykepro/rdiff/pkg/format/librsync"
+	"github.com/Psykepro/rdiff/pkg/hash"
+)
+
+// Value of the -chunk-size flag picking the chunk size from the length of the file.
+const chunkSizeAuto = "auto"
+
+// Values of the -chunking flag
+const (
+	chunkingFixed = "fixed"
+	chunkingCDC   = "cdc"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: rdiff <command> [arguments]")
-		fmt.Println("Commands:")
-		fmt.Println("  signature -file <path_to_file> -chunk-size <chunk_size> -output <output_file>")
-		fmt.Println("  delta -signature <signature_file> -updated <updated_file> -output <output_file>")
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "Usage: rdiff <command> [arguments]")
+		fmt.Fprintln(os.Stderr, "Commands:")
+		fmt.Fprintln(os.Stderr, "  signature -file <path_to_file> -chunk-size <chunk_size> [-rolling <rolling_hash>] [-chunking fixed|cdc] -output <output_file> [-format rdiff|librsync] [-progress[=json]]")
+		fmt.Fprintln(os.Stderr, "  delta -signature <signature_file> -updated <updated_file> -output <output_file> [-format rdiff|librsync] [-progress[=json]]")
+		fmt.Fprintln(os.Stderr, "  patch -basis <original_file> -delta <delta_file> -output <output_file> [-format rdiff|librsync]")
+		fmt.Fprintln(os.Stderr, "  diff -old <original_file> -new <updated_file> -output <output_file> [-chunk-size <chunk_size>] [-format rdiff|librsync] [-progress[=json]]")
+		fmt.Fprintln(os.Stderr, "  print -delta <delta_file>")
+		fmt.Fprintln(os.Stderr, "Every file argument accepts - for the standard input or output.")
+		os.Exit(exitUsage)
 	}
 
 	command := os.Args[1]
+	ctx := signalContext()
 	switch command {
 	case "signature":
 		signatureCmd := flag.NewFlagSet("signature", flag.ExitOnError)
 		file := signatureCmd.String("file", "", "Path to the file for which signatures will be generated")
-		chunkSize := signatureCmd.Int("chunk-size", 16, "Size of each chunk in bytes")
+		chunkSizeValue := signatureCmd.String("chunk-size", "16", "Size of each chunk in bytes, or auto to pick it from the file length. Average size of content-defined chunks")
+		chunking := signatureCmd.String("chunking", chunkingFixed, "Chunks of a fixed size or content-defined chunks (fixed or cdc)")
+		minChunkSize := signatureCmd.Int("min-chunk-size", 0, "Smallest content-defined chunk in bytes, 0 for a quarter of the chunk size")
+		maxChunkSize := signatureCmd.Int("max-chunk-size", 0, "Largest content-defined chunk in bytes, 0 for 8 times the chunk size")
+		rollingName := signatureCmd.String("rolling", "", "Rolling hash of the chunks (adler32, rollsum, rabinkarp or buzhash), defaults to adler32 or to rollsum for librsync")
+		strongHashName := signatureCmd.String("strong-hash", differ.DefaultStrongHash.String(), "Strong hash of the chunks (blake2b, sha256 or md4)")
+		strongLength := signatureCmd.Int("strong-length", 0, "Length in bytes the strong hashes are truncated to, 0 keeps the full hash")
 		output := signatureCmd.String("output", "", "Path to the output file where the signatures will be stored")
+		format := signatureCmd.String("format", formatRdiff, "Format of the signature file (rdiff or librsync)")
+		jobs := signatureCmd.Int("jobs", runtime.NumCPU(), "Number of chunks hashed in parallel, regular files only")
+		var progress progressFlag
+		signatureCmd.Var(&progress, "progress", "Report the progress to the standard error, as a status line or with -progress=json as JSON lines")
 		signatureCmd.Parse(os.Args[2:])
 
-		if *file == "" || *output == "" {
+		if *file == "" || *output == "" || *strongLength < 0 || *jobs < 1 || !validFormat(*format) ||
+			(*chunking != chunkingFixed && *chunking != chunkingCDC) || *minChunkSize < 0 || *maxChunkSize < 0 || *maxChunkSize > fileio.MaxChunkSize {
 			signatureCmd.Usage()
-			os.Exit(1)
+			os.Exit(exitUsage)
+		}
+
+		chunkSize, err := parseChunkSize(*chunkSizeValue, *file)
+		if err != nil {
+			fatal(err)
+		}
+
+		strongHash, err := hash.ParseStrongHash(*strongHashName)
+		if err != nil {
+			fatal(err)
+		}
+
+		weakHash := differ.DefaultWeakHash
+		if *format == formatLibrsync {
+			weakHash = librsync.WeakHash
+		}
+		if *rollingName != "" {
+			if weakHash, err = hash.ParseWeakHash(*rollingName); err != nil {
+				fatal(err)
+			}
 		}
 
-		generateSignatures(*file, *chunkSize, *output)
+		options := []differ.Option{differ.WithWeakHash(weakHash), differ.WithStrongHash(strongHash, *strongLength), differ.WithJobs(*jobs)}
+		options = append(options, progressOptions(progress)...)
+		if *chunking == chunkingCDC {
+			// The FastCDC paper uses chunks of 2 KiB to 64 KiB around an average of 8 KiB
+			if *minChunkSize == 0 {
+				*minChunkSize = max(chunkSize/4, 1)
+			}
+			if *maxChunkSize == 0 {
+				*maxChunkSize = min(chunkSize*8, fileio.MaxChunkSize)
+			}
+			options = append(options, differ.WithContentDefinedChunking(*minChunkSize, *maxChunkSize))
+		}
+		generateSignatures(ctx, *file, *output, *format, chunkSize, options...)
 	case "delta":
 		deltaCmd := flag.NewFlagSet("delta", flag.ExitOnError)
 		signatureFile := deltaCmd.String("signature", "", "Path to the file containing the signatures of the original file")
 		updatedFile := deltaCmd.String("updated", "", "Path to the updated version of the file")
-		chunkSize := deltaCmd.Int("chunk-size", 16, "Size of each chunk in bytes")
 		output := deltaCmd.String("output", "", "Path to the output file where the delta will be stored")
+		format := deltaCmd.String("format", formatRdiff, "Format of the signature and delta files (rdiff or librsync)")
+		jobs := deltaCmd.Int("jobs", runtime.NumCPU(), "Number of segments of the updated file searched in parallel, regular files only")
+		var progress progressFlag
+		deltaCmd.Var(&progress, "progress", "Report the progress to the standard error, as a status line or with -progress=json as JSON lines")
 		deltaCmd.Parse(os.Args[2:])
 
-		if *signatureFile == "" || *updatedFile == "" || *output == "" || *chunkSize < 1 {
+		if *signatureFile == "" || *updatedFile == "" || *output == "" || *jobs < 1 || !validFormat(*format) || bothStdin(*signatureFile, *updatedFile) {
 			deltaCmd.Usage()
-			os.Exit(1)
+			os.Exit(exitUsage)
+		}
+
+		generateDelta(ctx, *signatureFile, *updatedFile, *output, *format, *jobs, progressOptions(progress)...)
+	case "patch":
+		patchCmd := flag.NewFlagSet("patch", flag.ExitOnError)
+		basisFile := patchCmd.String("basis", "", "Path to the original file the delta was generated against")
+		deltaFile := patchCmd.String("delta", "", "Path to the file containing the delta")
+		output := patchCmd.String("output", "", "Path to the output file where the updated file will be stored")
+		format := patchCmd.String("format", formatRdiff, "Format of the delta file (rdiff or librsync)")
+		patchCmd.Parse(os.Args[2:])
+
+		if *basisFile == "" || *deltaFile == "" || *output == "" || !validFormat(*format) || bothStdin(*basisFile, *deltaFile) {
+			patchCmd.Usage()
+			os.Exit(exitUsage)
+		}
+
+		if *format == formatLibrsync {
+			applyLibrsyncDelta(ctx, *basisFile, *deltaFile, *output)
+		} else {
+			applyDelta(ctx, *basisFile, *deltaFile, *output)
 		}
+	case "diff":
+		diffCmd := flag.NewFlagSet("diff", flag.ExitOnError)
+		oldFile := diffCmd.String("old", "", "Path to the original file")
+		newFile := diffCmd.String("new", "", "Path to the updated version of the file")
+		output := diffCmd.String("output", "", "Path to the output file where the delta will be stored")
+		chunkSizeValue := diffCmd.String("chunk-size", chunkSizeAuto, "Size of each chunk in bytes, or auto to pick it from the length of the original file")
+		format := diffCmd.String("format", formatRdiff, "Format of the delta file (rdiff or librsync)")
+		jobs := diffCmd.Int("jobs", runtime.NumCPU(), "Number of workers hashing and searching in parallel, regular files only")
+		var progress progressFlag
+		diffCmd.Var(&progress, "progress", "Report the progress to the standard error, as a status line or with -progress=json as JSON lines")
+		diffCmd.Parse(os.Args[2:])
 
-		fileHandler := fileio.NewFileHandler(*chunkSize) // Use the chunkSize from the command line arguments
-		generateDelta(*signatureFile, *updatedFile, *output, fileHandler)
+		if *oldFile == "" || *newFile == "" || *output == "" || *jobs < 1 || !validFormat(*format) || bothStdin(*oldFile, *newFile) {
+			diffCmd.Usage()
+			os.Exit(exitUsage)
+		}
+
+		chunkSize, err := parseChunkSize(*chunkSizeValue, *oldFile)
+		if err != nil {
+			fatal(err)
+		}
+
+		options := progressOptions(progress)
+		if *format == formatLibrsync {
+			options = append(options, differ.WithWeakHash(librsync.WeakHash))
+		}
+		diff(ctx, *oldFile, *newFile, *output, *format, chunkSize, *jobs, options...)
 	case "print":
 		printCmd := flag.NewFlagSet("print", flag.ExitOnError)
 		deltaFile := printCmd.String("delta", "", "Path to the file containing the delta")
@@ -56,13 +167,13 @@ func main() {
 
 		if *deltaFile == "" {
 			printCmd.Usage()
-			os.Exit(1)
+			os.Exit(exitUsage)
 		}
 
 		printDelta(*deltaFile)
 	default:
-		fmt.Printf("Unknown command: %s\n", command)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
+		os.Exit(exitUsage)
 	}
 }
 
@@ -70,49 +181,329 @@ func printDelta(deltaFile string) {
 	fileHandler := fileio.NewFileHandler(0) // Chunk size is not used for reading delta
 	delta, err := fileHandler.ReadDelta(deltaFile)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
 	prettyDelta := differ.PrettifyDelta(delta)
 	fmt.Printf("Pretty Delta:\n%+v\n", prettyDelta)
 }
 
-func generateSignatures(file string, chunkSize int, output string) {
-	fileHandler := fileio.NewFileHandler(chunkSize)
-	reader, err := fileHandler.Open(file)
+func generateSignatures(ctx context.Context, file, output, format string, chunkSize int, options ...differ.Option) {
+	input, err := openInput(file)
+	if err != nil {
+		fatal(err)
+	}
+	defer input.Close()
+	inputInfo, err := input.Stat()
+	if err != nil {
+		fatal(readError("stat", file, err))
+	}
+
+	out, err := createOutput(output)
+	if err != nil {
+		fatal(err)
+	}
+
+	differ := differ.New(chunkSize, options...)
+	signatures := differ.NewSignatureTable()
+	writer, err := newSignatureWriter(out, format, signatures)
+	if err != nil {
+		fatal(err)
+	}
+	// The signatures are written while the file is read, so they are never held in memory.
+	// Regular files can be read at any offset and are hashed in parallel, anything else is read in order.
+	if inputInfo.Mode().IsRegular() {
+		err = differ.StreamSignaturesAtContext(ctx, input, inputInfo.Size(), writer)
+	} else {
+		err = differ.StreamSignaturesContext(ctx, bufio.NewReader(input), writer)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		fatal(err)
+	}
+
+	if signatures.ContentDefined() {
+		info("Signatures generated with content-defined chunks of %d to %d bytes, %d on average, and saved to: %s",
+			signatures.MinChunkSize, signatures.MaxChunkSize, chunkSize, displayPath(output))
+	} else {
+		info("Signatures generated with chunk size %d and saved to: %s", chunkSize, displayPath(output))
+	}
+}
+
+// Signature encoder of either format.
+type signatureWriter interface {
+	differ.SignatureSink
+	Close() error
+}
+
+func newSignatureWriter(w io.Writer, format string, signatures *differ.SignatureTable) (signatureWriter, error) {
+	if format == formatLibrsync {
+		return librsync.NewSignatureWriter(w, signatures)
+	}
+	return fileio.NewSignatureWriter(w, signatures)
+}
+
+func generateDelta(ctx context.Context, signatureFile, updatedFile, output, format string, jobs int, options ...differ.Option) {
+	fileHandler := fileio.NewFileHandler(0) // Chunk size is not used for reading signatures
+	var signatures *differ.SignatureTable
+	var err error
+	if format == formatLibrsync {
+		signatures, err = readLibrsyncSignatures(ctx, signatureFile)
+	} else {
+		signatures, err = fileHandler.ReadSignaturesContext(ctx, signatureFile)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	writeDelta(ctx, signatures, updatedFile, output, format, jobs, options...)
+}
+
+/*
+Generates the delta of the updated file against the original file directly. The signatures of the
+original file are only kept in memory, so that no signature file has to be written and read back.
+*/
+func diff(ctx context.Context, oldFile, newFile, output, format string, chunkSize, jobs int, options ...differ.Option) {
+	input, err := openInput(oldFile)
+	if err != nil {
+		fatal(err)
+	}
+	defer input.Close()
+	inputInfo, err := input.Stat()
+	if err != nil {
+		fatal(readError("stat", oldFile, err))
+	}
+
+	differ := differ.New(chunkSize, append(options, differ.WithJobs(jobs))...)
+	signatures := differ.NewSignatureTable()
+	if inputInfo.Mode().IsRegular() {
+		err = differ.StreamSignaturesAtContext(ctx, input, inputInfo.Size(), signatures)
+	} else {
+		err = differ.StreamSignaturesContext(ctx, bufio.NewReader(input), signatures)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	writeDelta(ctx, signatures, newFile, output, format, jobs, options...)
+}
+
+// Writes the delta of the updated file against signatures to output in the given format.
+func writeDelta(ctx context.Context, signatures *differ.SignatureTable, updatedFile, output, format string, jobs int, options ...differ.Option) {
+	input, err := openInput(updatedFile)
+	if err != nil {
+		fatal(err)
+	}
+	defer input.Close()
+	inputInfo, err := input.Stat()
+	if err != nil {
+		fatal(readError("stat", updatedFile, err))
+	}
+
+	file, err := createOutput(output)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 
-	differ := differ.New(chunkSize)
-	signatures := differ.GenerateSignatures(reader)
+	// The differ hands the length and digest of the updated file to the rdiff delta writer, so that patching can be verified
+	var writer deltaWriter
+	if format == formatLibrsync {
+		writer, err = librsync.NewDeltaWriter(file, signatures)
+	} else {
+		writer, err = fileio.NewDeltaWriter(file, signatures)
+	}
+	if err != nil {
+		fatal(err)
+	}
 
-	err = fileHandler.WriteSignatures(signatures, output)
+	// The delta is written while the updated file is read, so it is never held in memory
+	differ := differ.New(signatures.ChunkSize, append(options, differ.WithJobs(jobs))...) // Use the chunkSize the signatures were generated with
+	if jobs > 1 && inputInfo.Mode().IsRegular() {
+		err = differ.GenerateDeltaAt(ctx, signatures, input, inputInfo.Size(), writer)
+	} else {
+		err = differ.GenerateDelta(ctx, signatures, bufio.NewReader(input), writer)
+	}
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		fatal(err)
 	}
 
-	fmt.Printf("Signatures generated and saved to: %s\n", output)
+	info("Delta generated and saved to: %s", displayPath(output))
 }
 
-func generateDelta(signatureFile, updatedFile, output string, fileHandler fileio.FileHandler) {
-	signatures, err := fileHandler.ReadSignatures(signatureFile)
+// Delta encoder of either format.
+type deltaWriter interface {
+	differ.DeltaSink
+	Close() error
+}
+
+func applyDelta(ctx context.Context, basisFile, deltaFile, output string) {
+	file, err := fileio.OpenFile(deltaFile)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
+	defer file.Close()
 
-	reader, err := fileHandler.Open(updatedFile)
+	// The delta is read and the updated file written through the context, so that a signal stops patching at the next block
+	input := fileio.NewContextReader(ctx, file)
+	deltaReader, err := fileio.NewDeltaReader(input)
 	if err != nil {
-		log.Fatal(err)
+		fatal(input.Cause(err))
 	}
 
-	differ := differ.New(fileHandler.ChunkSize())
-	delta := differ.GenerateDelta(signatures, reader)
+	basis, closeBasis, err := openBasis(basisFile)
+	if err != nil {
+		fatal(err)
+	}
+	defer closeBasis()
+	// A delta applied to another original file would build a wrong file, so the original file is checked first
+	if err := verifyBasis(ctx, deltaReader, basis, basisFile); err != nil {
+		fatal(err)
+	}
 
-	err = fileHandler.WriteDelta(delta, output)
+	// The updated file only replaces output once it is verified
+	updated, err := createRenamedOutput(output)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
+	}
+
+	// Everything written to the updated file is checksummed and verified against the delta
+	target := fileio.NewFileChecksum()
+	writer := bufio.NewWriter(io.MultiWriter(fileio.NewContextWriter(ctx, updated), target))
+
+	differ := differ.New(deltaReader.ChunkSize())
+	for {
+		op, err := deltaReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fatal(input.Cause(err))
+		}
+		if err := differ.ApplyOp(basis, op, writer); err != nil {
+			fatal(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		fatal(err)
+	}
+	if err := deltaReader.Verify(target); err != nil {
+		fatal(&fileio.Error{Op: "verify", Path: output, Err: err})
+	}
+	if err := updated.Close(); err != nil {
+		fatal(err)
+	}
+
+	info("Delta applied and updated file saved to: %s", displayPath(output))
+}
+
+// Reads the whole basis file and checks its length and digest against the ones stored in the delta.
+func verifyBasis(ctx context.Context, deltaReader *fileio.DeltaReader, basis io.ReaderAt, basisFile string) error {
+	checksum := fileio.NewFileChecksum()
+	reader := fileio.NewContextReader(ctx, io.NewSectionReader(basis, 0, math.MaxInt64))
+	if _, err := io.Copy(checksum, reader); err != nil {
+		return &fileio.Error{Op: "read", Path: basisFile, Err: differ.NewReadOriginalError(reader.Cause(err))}
+	}
+	if err := deltaReader.VerifyBasis(checksum); err != nil {
+		return &fileio.Error{Op: "verify", Path: basisFile, Err: err}
 	}
+	return nil
+}
+
+// Opens the file at path, or returns the standard input for fileio.StdStream.
+func openInput(path string) (*os.File, error) {
+	if path == fileio.StdStream {
+		return os.Stdin, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, readError("open", path, err)
+	}
+	return file, nil
+}
+
+// Wraps an error reading path in a *fileio.Error naming the file.
+func readError(op, path string, err error) error {
+	return &fileio.Error{Op: op, Path: path, Err: fileio.NewReadFileError(fileio.PathErrorCause(err))}
+}
+
+/*
+Opens the basis file for random access. The standard input cannot be read at random offsets,
+so it is first copied to a temporary file, which is removed again on close.
+*/
+func openBasis(basisFile string) (io.ReaderAt, func(), error) {
+	if basisFile != fileio.StdStream {
+		file, err := os.Open(basisFile)
+		if err != nil {
+			return nil, nil, readError("open", basisFile, err)
+		}
+		return file, func() { file.Close() }, nil
+	}
+
+	file, err := os.CreateTemp("", "rdiff-basis-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	closeFile := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	unfinishedFiles = append(unfinishedFiles, file.Name())
+	if _, err := io.Copy(file, os.Stdin); err != nil {
+		closeFile()
+		return nil, nil, readError("read", basisFile, err)
+	}
+	return file, closeFile, nil
+}
+
+/*
+Parses the -chunk-size flag. For auto the chunk size is recommended from the length of the file, which is only
+known in advance for regular files, so the minimum recommended chunk size is used for the standard input and pipes.
+*/
+func parseChunkSize(value, file string) (int, error) {
+	if value != chunkSizeAuto {
+		chunkSize, err := strconv.Atoi(value)
+		if err != nil || chunkSize < 1 || chunkSize > fileio.MaxChunkSize {
+			return 0, fmt.Errorf("invalid chunk size %q, expected a positive number up to %d or %s", value, fileio.MaxChunkSize, chunkSizeAuto)
+		}
+		return chunkSize, nil
+	}
+
+	if file != fileio.StdStream {
+		fileInfo, err := os.Stat(file)
+		if err != nil {
+			return 0, readError("stat", file, err)
+		}
+		if fileInfo.Mode().IsRegular() {
+			return differ.RecommendedBlockSize(fileInfo.Size()), nil
+		}
+	}
+	return differ.MinBlockSize, nil
+}
+
+// Only one of the inputs of a command can be read from the standard input.
+func bothStdin(first, second string) bool {
+	return first == fileio.StdStream && second == fileio.StdStream
+}
+
+func displayPath(path string) string {
+	if path == fileio.StdStream {
+		return "standard output"
+	}
+	return path
+}
 
-	fmt.Printf("Delta generated and saved to: %s\n", output)
+// Informational messages go to the standard error, so that they never mix with an output written to the standard output.
+func info(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
 }
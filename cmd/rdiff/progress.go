@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Psykepro/rdiff/pkg/differ"
+)
+
+// Values of the -progress flag
+const (
+	progressText = "text"
+	progressJSON = "json"
+)
+
+// Time between two reports of the progress, besides the last one which is always written.
+const progressRefresh = 500 * time.Millisecond
+
+/*
+Value of the -progress flag. Given alone it renders a status line, -progress=json writes one JSON object per
+line instead, which suits scripts and dashboards.
+*/
+type progressFlag string
+
+func (f *progressFlag) String() string {
+	return string(*f)
+}
+
+func (f *progressFlag) Set(value string) error {
+	switch value {
+	case "true", progressText:
+		*f = progressText
+	case "false":
+		*f = ""
+	case progressJSON:
+		*f = progressJSON
+	default:
+		return fmt.Errorf("invalid progress %q, expected %s or %s", value, progressText, progressJSON)
+	}
+	return nil
+}
+
+// Lets -progress be given without a value.
+func (f *progressFlag) IsBoolFlag() bool {
+	return true
+}
+
+// Returns the options reporting the progress to the standard error in the format of the flag, none when it is not set.
+func progressOptions(format progressFlag) []differ.Option {
+	if format == "" {
+		return nil
+	}
+	renderer := &progressRenderer{format: format}
+	return []differ.Option{differ.WithProgress(renderer.render)}
+}
+
+// Progress written as a JSON line.
+type progressLine struct {
+	Stage      differ.Stage `json:"stage"`
+	Read       int64        `json:"read"`
+	Matched    int64        `json:"matched"`
+	Literal    int64        `json:"literal"`
+	Elapsed    float64      `json:"elapsed_seconds"`
+	Throughput float64      `json:"bytes_per_second"`
+	Done       bool         `json:"done"`
+}
+
+type progressRenderer struct {
+	format   progressFlag
+	rendered time.Time
+}
+
+func (r *progressRenderer) render(progress differ.Progress) {
+	if !progress.Done && time.Since(r.rendered) < progressRefresh {
+		return
+	}
+	r.rendered = time.Now()
+
+	if r.format == progressJSON {
+		line, _ := json.Marshal(progressLine{
+			Stage:      progress.Stage,
+			Read:       progress.Read,
+			Matched:    progress.Matched,
+			Literal:    progress.Literal,
+			Elapsed:    progress.Elapsed.Seconds(),
+			Throughput: progress.Throughput(),
+			Done:       progress.Done,
+		})
+		fmt.Fprintf(os.Stderr, "%s\n", line)
+		return
+	}
+
+	status := fmt.Sprintf("%s: %s read", progress.Stage, formatBytes(float64(progress.Read)))
+	if progress.Stage == differ.StageDelta {
+		status += fmt.Sprintf(", %s matched, %s literal", formatBytes(float64(progress.Matched)), formatBytes(float64(progress.Literal)))
+	}
+	status += fmt.Sprintf(", %s/s", formatBytes(progress.Throughput()))
+	// The status line is rewritten in place, and only ends once the stage is done
+	end := ""
+	if progress.Done {
+		end = "\n"
+	}
+	fmt.Fprintf(os.Stderr, "\r%-72s%s", status, end)
+}
+
+// Formats a number of bytes with a binary unit.
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f %s", bytes, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", bytes, units[unit])
+}
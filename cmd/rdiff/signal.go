@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/Psykepro/rdiff/pkg/fileio"
+)
+
+// Files written by the running command, which are removed when it fails or is interrupted before finishing them.
+var unfinishedFiles []string
+
+/*
+Returns a context cancelled by the first SIGINT or SIGTERM, so that the running command stops at the next
+chunk and removes its partial outputs. The signals are restored afterwards, so a second one kills rdiff at once.
+*/
+func signalContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx
+}
+
+/*
+Creates the output file, which is removed again if the command fails before finishing it. Its write errors
+are reported as *fileio.Error, and it has to be closed explicitly, since the last writes may only fail then.
+*/
+func createOutput(path string) (io.WriteCloser, error) {
+	file, err := fileio.CreateFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if path != fileio.StdStream {
+		unfinishedFiles = append(unfinishedFiles, path)
+	}
+	return outputFile{file: file, path: path}, nil
+}
+
+type outputFile struct {
+	file io.WriteCloser
+	path string
+}
+
+func (f outputFile) Write(p []byte) (int, error) {
+	n, err := f.file.Write(p)
+	if err != nil {
+		err = f.error(err)
+	}
+	return n, err
+}
+
+func (f outputFile) Close() error {
+	if err := f.file.Close(); err != nil {
+		return f.error(err)
+	}
+	return nil
+}
+
+func (f outputFile) error(err error) error {
+	return &fileio.Error{Op: "write", Path: f.path, Err: fileio.NewWriteFileError(fileio.PathErrorCause(err))}
+}
+
+/*
+Creates the output file like createOutput, but writes it to a temporary file in the same directory which Close
+renames to path, so that path never holds a partial or unverified file. The standard output is written directly.
+*/
+func createRenamedOutput(path string) (io.WriteCloser, error) {
+	if path == fileio.StdStream {
+		return createOutput(path)
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".rdiff-*")
+	if err != nil {
+		return nil, &fileio.Error{Op: "create", Path: path, Err: fileio.NewCreateFileError(fileio.PathErrorCause(err))}
+	}
+	unfinishedFiles = append(unfinishedFiles, file.Name())
+	output := renamedOutput{outputFile: outputFile{file: file, path: path}, temporary: file.Name()}
+	// Temporary files are only readable by their owner, unlike the files os.Create makes
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		return nil, output.error(err)
+	}
+	return output, nil
+}
+
+type renamedOutput struct {
+	outputFile
+	temporary string
+}
+
+func (f renamedOutput) Close() error {
+	if err := f.outputFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.temporary, f.path); err != nil {
+		return f.error(err)
+	}
+	return nil
+}
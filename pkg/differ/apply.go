@@ -0,0 +1,103 @@
+package differ
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Returned for an instruction addressing bytes no original file can hold, which only a corrupted delta contains.
+var ErrInvalidOp = fmt.Errorf("invalid delta instruction")
+
+// Apply rebuilds the updated file by executing the instructions of the delta in order,
+// copying chunks from the original file and writing the literals in between.
+func (d *Differ) Apply(original io.ReaderAt, delta Delta, out io.Writer) error {
+	return d.ApplyContext(context.Background(), original, delta, out)
+}
+
+// ApplyContext rebuilds the updated file like Apply, and stops with a CanceledError once ctx is done.
+func (d *Differ) ApplyContext(ctx context.Context, original io.ReaderAt, delta Delta, out io.Writer) error {
+	written := &countingWriter{writer: out}
+	for _, op := range delta {
+		if err := checkContext(ctx, written.count); err != nil {
+			return err
+		}
+		if err := d.ApplyOp(original, op, written); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Counts the bytes written through it.
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.count += int64(n)
+	return n, err
+}
+
+/*
+ApplyOp executes a single instruction of a delta, so that deltas can be applied while they are read.
+COPY instructions address chunks of the chunk size of the differ, which has to be the chunk size
+of the signatures the delta was generated from.
+*/
+func (d *Differ) ApplyOp(original io.ReaderAt, op Op, out io.Writer) error {
+	switch op.Type {
+	case OpCopy:
+		// The chunks come from a delta file, so their end is checked to fit in an offset before it is calculated
+		if op.BlockIndex < 0 || op.Count < 0 || int64(op.BlockIndex) > math.MaxInt64/int64(d.chunkSize)-int64(op.Count) {
+			return fmt.Errorf("%w: copy of %d chunks from chunk %d", ErrInvalidOp, op.Count, op.BlockIndex)
+		}
+		offset := int64(op.BlockIndex) * int64(d.chunkSize)
+		length := int64(op.Count) * int64(d.chunkSize)
+		// The last chunk of the original file can be shorter, so copying stops at its end
+		n, err := io.Copy(out, NewOriginalReader(original, offset, length))
+		if err != nil {
+			return err
+		}
+		// Only the last copied chunk may end early, anything shorter means the original file was truncated
+		if op.Count > 0 && n <= length-int64(d.chunkSize) {
+			return NewReadOriginalError(io.ErrUnexpectedEOF)
+		}
+		return nil
+	case OpCopyRange:
+		if op.Offset < 0 || op.Length < 0 || op.Offset > math.MaxInt64-int64(op.Length) {
+			return fmt.Errorf("%w: copy of %d bytes at offset %d", ErrInvalidOp, op.Length, op.Offset)
+		}
+		_, err := io.CopyN(out, NewOriginalReader(original, op.Offset, int64(op.Length)), int64(op.Length))
+		if err == io.EOF {
+			return NewReadOriginalError(io.ErrUnexpectedEOF)
+		}
+		return err
+	case OpLiteral:
+		_, err := out.Write(op.Data)
+		return err
+	}
+	return nil
+}
+
+/*
+Reads length bytes of original starting at offset, like an io.SectionReader, and wraps its read errors with
+ErrReadOriginal, so that they are told apart from the write errors of the updated file while copying.
+*/
+func NewOriginalReader(original io.ReaderAt, offset, length int64) io.Reader {
+	return originalReader{io.NewSectionReader(original, offset, length)}
+}
+
+type originalReader struct {
+	reader io.Reader
+}
+
+func (r originalReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = NewReadOriginalError(err)
+	}
+	return n, err
+}
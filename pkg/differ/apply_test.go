@@ -0,0 +1,191 @@
+package differ
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Psykepro/rdiff/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	originalFilePath = "../../test/testdata/original.txt"
+	modifiedFilePath = "../../test/testdata/modified.txt"
+)
+
+func TestApply(t *testing.T) {
+	testCases := []struct {
+		name string
+		txt1 string
+		txt2 string
+	}{
+		{
+			name: "Chunk Change",
+			txt1: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
+			txt2: "This is a Rolling hashes file difference algorithm. It should check for changes in file and text",
+		},
+		{
+			name: "Chunk Deletion",
+			txt1: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
+			txt2: "This is a Rolling hash file diff algorithm. It should check for changes",
+		},
+		{
+			name: "Chunk Addition",
+			txt1: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
+			txt2: "This is a Rolling hash file diff algorithm. It should check for changes in file and text. This is written in a way to detect addition to the text",
+		},
+		{
+			name: "Chunks Moved And Repeated",
+			txt1: "First chunk ****Second chunk ***",
+			txt2: "Second chunk ***First chunk ****First chunk ****",
+		},
+		{
+			name: "No Changes",
+			txt1: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
+			txt2: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
+		},
+		{
+			name: "First Chunk Change",
+			txt1: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
+			txt2: "The a Rolling hash file diff algorithm. It should check for changes in file and text",
+		},
+		{
+			name: "All Chunks Change",
+			txt1: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
+			txt2: "This is a different text and it is different from all the chunks above",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			differInstance := New(16)
+			patched := roundTrip(t, differInstance, []byte(tc.txt1), []byte(tc.txt2))
+			assert.Equal(t, tc.txt2, string(patched))
+		})
+	}
+}
+
+func TestApplyTestData(t *testing.T) {
+	original, err := os.ReadFile(originalFilePath)
+	assert.NoError(t, err)
+	modified, err := os.ReadFile(modifiedFilePath)
+	assert.NoError(t, err)
+
+	for _, weakHash := range []hash.WeakHash{hash.Adler32, hash.Rollsum, hash.RabinKarp, hash.Buzhash} {
+		t.Run(weakHash.String(), func(t *testing.T) {
+			differInstance := New(16, WithWeakHash(weakHash))
+			assert.Equal(t, modified, roundTrip(t, differInstance, original, modified))
+			assert.Equal(t, original, roundTrip(t, differInstance, modified, original))
+		})
+	}
+}
+
+func TestApplyInvalidOps(t *testing.T) {
+	testCases := []struct {
+		name string
+		op   Op
+	}{
+		{name: "Negative Chunk", op: Copy(-1, 1)},
+		{name: "Negative Count", op: Copy(0, -1)},
+		{name: "Chunk Past Largest Offset", op: Copy(math.MaxInt64/16+1, 1)},
+		{name: "Copy Past Largest Offset", op: Copy(math.MaxInt64/16, 1)},
+		{name: "Negative Offset", op: CopyRange(-1, 1)},
+		{name: "Negative Length", op: CopyRange(0, -1)},
+		{name: "Range Past Largest Offset", op: CopyRange(math.MaxInt64, 1)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := New(16).ApplyOp(bytes.NewReader([]byte("original file")), tc.op, io.Discard)
+			assert.ErrorIs(t, err, ErrInvalidOp)
+		})
+	}
+}
+
+func TestEmptyAndTinyFiles(t *testing.T) {
+	testCases := []struct {
+		name          string
+		original      string
+		updated       string
+		expectedDelta Delta
+	}{
+		{
+			name:          "Both Empty",
+			original:      "",
+			updated:       "",
+			expectedDelta: nil,
+		},
+		{
+			name:          "Empty Original",
+			original:      "",
+			updated:       "Written from scratch",
+			expectedDelta: Delta{Literal([]byte("Written from scratch"))},
+		},
+		{
+			name:          "Empty Updated",
+			original:      "Everything is deleted",
+			updated:       "",
+			expectedDelta: nil,
+		},
+		{
+			name:          "Smaller Than A Chunk Unchanged",
+			original:      "tiny",
+			updated:       "tiny",
+			expectedDelta: Delta{Copy(0, 1)},
+		},
+		{
+			name:          "Smaller Than A Chunk Changed",
+			original:      "tiny",
+			updated:       "tidy",
+			expectedDelta: Delta{Literal([]byte("tidy"))},
+		},
+		{
+			name:          "Single Byte",
+			original:      "a",
+			updated:       "a",
+			expectedDelta: Delta{Copy(0, 1)},
+		},
+		{
+			name:          "One Chunk And A Short One",
+			original:      "Exactly one chunk and more",
+			updated:       "Exactly one chunk and more",
+			expectedDelta: Delta{Copy(0, 2)},
+		},
+		{
+			name:          "Tiny Original In Larger Updated",
+			original:      "tiny",
+			updated:       "a tiny",
+			expectedDelta: Delta{Literal([]byte("a ")), Copy(0, 1)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			differInstance := New(16)
+			signatures, err := differInstance.GenerateSignatures(strings.NewReader(tc.original))
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(tc.original)), signatures.FileSize())
+
+			delta := generateDelta(t, differInstance, signatures, []byte(tc.updated))
+			assert.Equal(t, tc.expectedDelta, delta)
+			assert.Equal(t, tc.updated, string(roundTrip(t, differInstance, []byte(tc.original), []byte(tc.updated))))
+		})
+	}
+}
+
+// roundTrip generates the delta from original to updated and applies it back to original.
+func roundTrip(t *testing.T, differInstance *Differ, original, updated []byte) []byte {
+	signatures, err := differInstance.GenerateSignatures(bufio.NewReader(bytes.NewReader(original)))
+	assert.NoError(t, err)
+	delta := generateDelta(t, differInstance, signatures, updated)
+
+	var patched bytes.Buffer
+	err = differInstance.Apply(bytes.NewReader(original), delta, &patched)
+	assert.NoError(t, err)
+	return patched.Bytes()
+}
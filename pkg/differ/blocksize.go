@@ -0,0 +1,22 @@
+package differ
+
+import "math"
+
+// Bounds of the chunk size recommended by RecommendedBlockSize, the same ones rsync uses.
+const (
+	MinBlockSize = 700
+	MaxBlockSize = 1 << 17
+)
+
+/*
+Recommends a chunk size for a file of fileSize bytes, following the heuristic of rsync. The chunk size
+grows with the square root of the file length, which balances the size of the signatures against how
+finely changes are found. It is rounded down to a multiple of 8 and kept within MinBlockSize and MaxBlockSize.
+*/
+func RecommendedBlockSize(fileSize int64) int {
+	if fileSize <= MinBlockSize*MinBlockSize {
+		return MinBlockSize
+	}
+	size := int64(math.Sqrt(float64(fileSize))) &^ 7
+	return int(min(max(size, MinBlockSize), MaxBlockSize))
+}
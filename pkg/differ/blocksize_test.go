@@ -0,0 +1,29 @@
+package differ
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecommendedBlockSize(t *testing.T) {
+	testCases := []struct {
+		name         string
+		fileSize     int64
+		expectedSize int
+	}{
+		{name: "Empty File", fileSize: 0, expectedSize: MinBlockSize},
+		{name: "Small File", fileSize: 4096, expectedSize: MinBlockSize},
+		{name: "Minimum Bound", fileSize: MinBlockSize * MinBlockSize, expectedSize: MinBlockSize},
+		{name: "Square Root", fileSize: 1000 * 1000, expectedSize: 1000},
+		{name: "Rounded Down To Multiple Of 8", fileSize: 2_000_000, expectedSize: 1408},
+		{name: "Large File", fileSize: 1 << 30, expectedSize: 32768},
+		{name: "Maximum Bound", fileSize: 1 << 40, expectedSize: MaxBlockSize},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedSize, RecommendedBlockSize(tc.fileSize))
+		})
+	}
+}
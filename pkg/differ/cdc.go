@@ -0,0 +1,189 @@
+package differ
+
+import (
+	"context"
+	"io"
+	"math/bits"
+)
+
+/*
+Random value of every byte used by the gear hash of content-defined chunking. Where chunks end depends on this
+table, so it is part of the signature format and must never change. It is generated from a fixed seed with splitmix64.
+*/
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x4644434443)
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+/*
+Splits a stream into content-defined chunks with FastCDC. A gear hash is rolled over the bytes after the
+minimum size, and a chunk ends where its top bits are all zero. Before the average size more bits have to
+be zero than after it, which keeps the sizes close to the average, and no chunk is longer than the maximum.
+Since the ends only depend on the bytes right before them, an insertion or a deletion only changes the
+chunks around it and the following chunks end at the same bytes as before.
+*/
+type cdcChunker struct {
+	reader  io.Reader
+	minSize int
+	avgSize int
+	maxSize int
+	maskS   uint64 // Mask before the average size, with one more bit than the average needs
+	maskL   uint64 // Mask after the average size, with one bit less than the average needs
+	buffer  []byte
+	start   int
+	end     int
+	eof     bool
+}
+
+func newCDCChunker(reader io.Reader, minSize, avgSize, maxSize int) *cdcChunker {
+	averageBits := bits.Len(uint(avgSize)) - 1
+	return &cdcChunker{
+		reader:  reader,
+		minSize: minSize,
+		avgSize: avgSize,
+		maxSize: maxSize,
+		maskS:   topBits(averageBits + 1),
+		maskL:   topBits(max(averageBits-1, 1)),
+		buffer:  make([]byte, 2*maxSize),
+	}
+}
+
+// Mask of the n most significant bits, which depend on the last 64 bytes rolled into the gear hash.
+func topBits(n int) uint64 {
+	return ^uint64(0) << (64 - min(n, 64))
+}
+
+// Returns the next chunk, which is only valid until the following call, or io.EOF after the last chunk.
+func (c *cdcChunker) next() ([]byte, error) {
+	if c.end-c.start < c.maxSize && !c.eof {
+		c.end = copy(c.buffer, c.buffer[c.start:c.end])
+		c.start = 0
+		n, err := io.ReadFull(c.reader, c.buffer[c.end:])
+		c.end += n
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	length := c.cut(c.buffer[c.start:c.end])
+	chunk := c.buffer[c.start : c.start+length]
+	c.start += length
+	return chunk, nil
+}
+
+// Length of the chunk at the start of data, which holds at least the maximum chunk size unless the stream ends in it.
+func (c *cdcChunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.minSize {
+		return n
+	}
+	n = min(n, c.maxSize)
+	normal := min(c.avgSize, n)
+
+	var fingerprint uint64
+	i := c.minSize
+	for ; i < normal; i++ {
+		fingerprint = fingerprint<<1 + gearTable[data[i]]
+		if fingerprint&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fingerprint = fingerprint<<1 + gearTable[data[i]]
+		if fingerprint&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// Streams the signatures of the content-defined chunks of the original file read from reader to sink.
+func (d *Differ) streamSignaturesCDC(ctx context.Context, reader io.Reader, sink SignatureSink) error {
+	chunker := newCDCChunker(reader, d.minChunkSize, d.chunkSize, d.maxChunkSize)
+	weak := d.weakHash.New(d.maxChunkSize)
+	strong := d.strongHash.New()
+	strongHash := make([]byte, 0, d.strongHash.Size())
+	var offset int64
+	for index := 0; ; index++ {
+		if err := checkContext(ctx, offset); err != nil {
+			return err
+		}
+		chunk, err := chunker.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return NewReadOriginalError(err)
+		}
+		weak.Reset()
+		weak.Write(chunk)
+		err = sink.WriteBlock(Block{
+			Index:      index,
+			Offset:     offset,
+			Length:     len(chunk),
+			WeakHash:   weak.Sum32(),
+			StrongHash: strongSum(strong, strongHash, chunk, d.strongLength),
+		})
+		if err != nil {
+			return err
+		}
+		offset += int64(len(chunk))
+	}
+}
+
+/*
+Streams the delta of the updated file read from reader against content-defined signatures to sink. The updated
+file is split the same way as the original one, so chunks are only looked up where they end instead of at every byte.
+Matching chunks become copies of their byte range in the original file and the others are written as literals.
+*/
+func (d *Differ) generateDeltaCDC(ctx context.Context, signatures *SignatureTable, reader io.Reader, sink DeltaSink, progress *progressTracker) error {
+	chunker := newCDCChunker(reader, signatures.MinChunkSize, signatures.ChunkSize, signatures.MaxChunkSize)
+	emitter := newDeltaEmitter(sink, d.flushSize)
+	emitter.progress = progress
+	weak := signatures.WeakHash.New(signatures.MaxChunkSize)
+	strong := signatures.StrongHash.New()
+	next := -1
+	var processed int64
+	for {
+		if err := checkContext(ctx, processed); err != nil {
+			return err
+		}
+		chunk, err := chunker.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return NewReadUpdatedError(err)
+		}
+		processed += int64(len(chunk))
+		progress.read(processed)
+		weak.Reset()
+		weak.Write(chunk)
+		index := findIndex(signatures, weak.Sum32(), chunk, strong, next)
+		if index == -1 {
+			next = -1
+			if err := emitter.literal(chunk...); err != nil {
+				return err
+			}
+			continue
+		}
+		next = index + 1
+		block := signatures.Blocks[index]
+		if err := emitter.copyRange(block.Offset, block.Length); err != nil {
+			return err
+		}
+	}
+	return emitter.flush()
+}
@@ -0,0 +1,162 @@
+package differ
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func chunkAll(t *testing.T, reader io.Reader, minSize, avgSize, maxSize int) [][]byte {
+	chunker := newCDCChunker(reader, minSize, avgSize, maxSize)
+	var chunks [][]byte
+	for {
+		chunk, err := chunker.next()
+		if err == io.EOF {
+			return chunks
+		}
+		assert.NoError(t, err)
+		chunks = append(chunks, append([]byte(nil), chunk...))
+	}
+}
+
+func TestCDCChunker(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	chunks := chunkAll(t, bytes.NewReader(data), 256, 1024, 8192)
+	assert.Equal(t, data, bytes.Join(chunks, nil))
+	for i, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk), 8192)
+		if i < len(chunks)-1 {
+			assert.GreaterOrEqual(t, len(chunk), 256)
+		}
+	}
+	average := len(data) / len(chunks)
+	assert.Greater(t, average, 512)
+	assert.Less(t, average, 2048)
+
+	// Where chunks end only depends on the data, not on how it is read
+	assert.Equal(t, chunks, chunkAll(t, iotest.OneByteReader(bytes.NewReader(data)), 256, 1024, 8192))
+	assert.Equal(t, chunks, chunkAll(t, iotest.HalfReader(bytes.NewReader(data)), 256, 1024, 8192))
+
+	// Data without any boundary is cut at the maximum size
+	zeros := chunkAll(t, bytes.NewReader(make([]byte, 20000)), 256, 1024, 8192)
+	assert.Equal(t, []int{8192, 8192, 3616}, chunkLengths(zeros))
+
+	_, err := newCDCChunker(iotest.ErrReader(io.ErrClosedPipe), 256, 1024, 8192).next()
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+func chunkLengths(chunks [][]byte) []int {
+	lengths := make([]int, 0, len(chunks))
+	for _, chunk := range chunks {
+		lengths = append(lengths, len(chunk))
+	}
+	return lengths
+}
+
+func TestCDCShiftedData(t *testing.T) {
+	original := make([]byte, 256<<10)
+	rand.New(rand.NewSource(2)).Read(original)
+	updated := append([]byte("a few inserted bytes"), original...)
+	updated = append(updated[:100000:100000], append([]byte("more in the middle"), updated[100000:]...)...)
+
+	differInstance := New(1024, WithContentDefinedChunking(256, 8192))
+	signatures, err := differInstance.GenerateSignatures(bytes.NewReader(original))
+	assert.NoError(t, err)
+	assert.True(t, signatures.ContentDefined())
+
+	delta := generateDelta(t, differInstance, signatures, updated)
+	var literals int
+	for _, op := range delta {
+		assert.NotEqual(t, OpCopy, op.Type)
+		literals += len(op.Data)
+	}
+	// Only the chunks around the insertions differ, all other chunks are found again
+	assert.Less(t, literals, 4*8192)
+	assert.Equal(t, updated, roundTrip(t, differInstance, original, updated))
+}
+
+func TestCDCRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name          string
+		original      string
+		updated       string
+		expectedDelta Delta
+	}{
+		{
+			name:          "Both Empty",
+			original:      "",
+			updated:       "",
+			expectedDelta: nil,
+		},
+		{
+			name:          "Empty Original",
+			original:      "",
+			updated:       "Written from scratch",
+			expectedDelta: Delta{Literal([]byte("Written from scratch"))},
+		},
+		{
+			name:          "Unchanged",
+			original:      "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
+			updated:       "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
+			expectedDelta: Delta{CopyRange(0, 88)},
+		},
+		{
+			name:     "Changed",
+			original: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
+			updated:  "This is a Rolling hashes file difference algorithm. It should check for changes in file and text",
+		},
+		{
+			name:     "Moved",
+			original: "First part of the file, then the second part of the file",
+			updated:  "then the second part of the file. First part of the file, ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			differInstance := New(8, WithContentDefinedChunking(4, 64))
+			if tc.expectedDelta != nil || tc.updated == "" {
+				signatures, err := differInstance.GenerateSignatures(bytes.NewReader([]byte(tc.original)))
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedDelta, generateDelta(t, differInstance, signatures, []byte(tc.updated)))
+			}
+			assert.Equal(t, tc.updated, string(roundTrip(t, differInstance, []byte(tc.original), []byte(tc.updated))))
+		})
+	}
+}
+
+func TestCDCParallelFallsBackToSequential(t *testing.T) {
+	original := make([]byte, 64<<10)
+	rand.New(rand.NewSource(3)).Read(original)
+	updated := append([]byte("prefix"), original...)
+
+	differInstance := New(1024, WithContentDefinedChunking(256, 8192), WithJobs(4))
+	signatures, err := differInstance.GenerateSignatures(bytes.NewReader(original))
+	assert.NoError(t, err)
+	parallelSignatures := differInstance.NewSignatureTable()
+	assert.NoError(t, differInstance.StreamSignaturesAt(bytes.NewReader(original), int64(len(original)), parallelSignatures))
+	assert.Equal(t, signatures, parallelSignatures)
+
+	var delta Delta
+	assert.NoError(t, differInstance.GenerateDeltaAt(context.Background(), signatures, bytes.NewReader(updated), int64(len(updated)), &delta))
+	assert.Equal(t, generateDelta(t, differInstance, signatures, updated), delta)
+}
+
+func TestWithContentDefinedChunking(t *testing.T) {
+	differInstance := New(1024, WithContentDefinedChunking(0, 10))
+	assert.Equal(t, 1, differInstance.minChunkSize)
+	assert.Equal(t, 1024, differInstance.maxChunkSize)
+
+	differInstance = New(1024, WithContentDefinedChunking(2048, 4096))
+	assert.Equal(t, 1024, differInstance.minChunkSize)
+	assert.Equal(t, 4096, differInstance.maxChunkSize)
+
+	assert.False(t, New(1024).NewSignatureTable().ContentDefined())
+}
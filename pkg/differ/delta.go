@@ -1,29 +1,193 @@
 package differ
 
-type Delta struct {
-	StartIndex      int
-	EndIndex        int
-	Deleted         bool
-	UpdatedLiterals []byte
+type OpType uint8
+
+const (
+	// Copies Count consecutive chunks of the original file starting at the chunk BlockIndex
+	OpCopy OpType = iota
+	// Writes the Data literals as they are
+	OpLiteral
+	// Copies Length bytes of the original file starting at Offset, used with content-defined chunks
+	OpCopyRange
+)
+
+// Single instruction of a delta. Applying all instructions of a delta in order produces the updated file.
+type Op struct {
+	Type       OpType
+	BlockIndex int
+	Count      int
+	Offset     int64
+	Length     int
+	Data       []byte
+}
+
+// Ordered list of instructions which fully describes the updated file in terms of the original one.
+type Delta []Op
+
+func Copy(blockIndex, count int) Op {
+	return Op{Type: OpCopy, BlockIndex: blockIndex, Count: count}
+}
+
+func CopyRange(offset int64, length int) Op {
+	return Op{Type: OpCopyRange, Offset: offset, Length: length}
 }
 
-type PrettyDelta struct {
-	startIndex      int
-	endIndex        int
-	deleted         bool
-	updatedLiterals string
+func Literal(data []byte) Op {
+	return Op{Type: OpLiteral, Data: data}
+}
+
+func (t OpType) String() string {
+	switch t {
+	case OpCopy:
+		return "COPY"
+	case OpLiteral:
+		return "LITERAL"
+	case OpCopyRange:
+		return "COPY_RANGE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+type PrettyOp struct {
+	op         string
+	blockIndex int
+	count      int
+	offset     int64
+	length     int
+	literals   string
 }
 
 // convert byte array to string so that it is easy to read
-func PrettifyDelta(deltas map[int]Delta) map[int]PrettyDelta {
-	prettyDelta := make(map[int]PrettyDelta)
-	for key, value := range deltas {
-		prettyDelta[key] = PrettyDelta{
-			startIndex:      value.StartIndex,
-			endIndex:        value.EndIndex,
-			deleted:         value.Deleted,
-			updatedLiterals: string(value.UpdatedLiterals),
-		}
+func PrettifyDelta(delta Delta) []PrettyOp {
+	prettyDelta := make([]PrettyOp, 0, len(delta))
+	for _, op := range delta {
+		prettyDelta = append(prettyDelta, PrettyOp{
+			op:         op.Type.String(),
+			blockIndex: op.BlockIndex,
+			count:      op.Count,
+			offset:     op.Offset,
+			length:     op.Length,
+			literals:   string(op.Data),
+		})
 	}
 	return prettyDelta
 }
+
+// Receives the instructions of a delta in order, as soon as they are found.
+type DeltaSink interface {
+	WriteOp(op Op) error
+}
+
+// Collects the instructions in memory, so that a Delta can be used as a DeltaSink.
+func (d *Delta) WriteOp(op Op) error {
+	*d = append(*d, op)
+	return nil
+}
+
+/*
+Buffers the instruction being built before handing it to the sink. A copy is held back while the
+following chunks extend it, literals are held back until a copy follows them or flushSize is reached,
+so that memory stays bounded however long the updated file is.
+*/
+type deltaEmitter struct {
+	sink      DeltaSink
+	copy      Op // Pending copy, no copy is pending while both Count and Length are zero
+	literals  []byte
+	flushSize int
+	progress  *progressTracker // Counts the matched and literal bytes as they are found, nil when not reported
+}
+
+func newDeltaEmitter(sink DeltaSink, flushSize int) *deltaEmitter {
+	return &deltaEmitter{sink: sink, flushSize: flushSize}
+}
+
+// Index of the chunk which would extend the pending copy, -1 when no copy is pending.
+func (e *deltaEmitter) next() int {
+	if e.copy.Type != OpCopy || e.copy.Count == 0 {
+		return -1
+	}
+	return e.copy.BlockIndex + e.copy.Count
+}
+
+// Adds a copy of the chunk at index, extending the pending copy when the chunk directly follows it.
+func (e *deltaEmitter) copyChunk(index int) error {
+	//Literals found before the chunk have to be written before copying it
+	if err := e.flushLiterals(); err != nil {
+		return err
+	}
+	e.progress.copiedChunk(index)
+	if index == e.next() {
+		e.copy.Count++
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.copy = Copy(index, 1)
+	return nil
+}
+
+// Adds a copy of a byte range of the original file, extending the pending copy when the range directly follows it.
+func (e *deltaEmitter) copyRange(offset int64, length int) error {
+	if err := e.flushLiterals(); err != nil {
+		return err
+	}
+	e.progress.copied(length)
+	if e.copy.Type == OpCopyRange && e.copy.Length > 0 && e.copy.Offset+int64(e.copy.Length) == offset {
+		e.copy.Length += length
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.copy = CopyRange(offset, length)
+	return nil
+}
+
+func (e *deltaEmitter) literal(data ...byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.progress.literal(len(data))
+	for len(data) > 0 {
+		n := min(e.flushSize-len(e.literals), len(data))
+		e.literals = append(e.literals, data[:n]...)
+		data = data[n:]
+		if len(e.literals) >= e.flushSize {
+			if err := e.flushLiterals(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *deltaEmitter) flush() error {
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	return e.flushLiterals()
+}
+
+func (e *deltaEmitter) flushCopy() error {
+	if e.copy.Count == 0 && e.copy.Length == 0 {
+		return nil
+	}
+	op := e.copy
+	e.copy = Op{}
+	return e.sink.WriteOp(op)
+}
+
+func (e *deltaEmitter) flushLiterals() error {
+	if len(e.literals) == 0 {
+		return nil
+	}
+	// The sink may keep the literals, so a new buffer is started instead of reusing this one
+	op := Literal(e.literals)
+	e.literals = nil
+	return e.sink.WriteOp(op)
+}
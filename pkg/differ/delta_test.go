@@ -9,24 +9,26 @@ import (
 func TestPrettifyDelta(t *testing.T) {
 	testCases := []struct {
 		name           string
-		input          map[int]Delta
-		expectedOutput map[int]PrettyDelta
+		input          Delta
+		expectedOutput []PrettyOp
 	}{
 		{
 			name: "Regular case",
-			input: map[int]Delta{
-				0: {StartIndex: 0, EndIndex: 16, Deleted: false, UpdatedLiterals: []byte("This is a test")},
-				1: {StartIndex: 17, EndIndex: 32, Deleted: true},
+			input: Delta{
+				Literal([]byte("This is a test")),
+				Copy(1, 2),
+				CopyRange(16, 40),
 			},
-			expectedOutput: map[int]PrettyDelta{
-				0: {startIndex: 0, endIndex: 16, deleted: false, updatedLiterals: "This is a test"},
-				1: {startIndex: 17, endIndex: 32, deleted: true, updatedLiterals: ""},
+			expectedOutput: []PrettyOp{
+				{op: "LITERAL", literals: "This is a test"},
+				{op: "COPY", blockIndex: 1, count: 2},
+				{op: "COPY_RANGE", offset: 16, length: 40},
 			},
 		},
 		{
 			name:           "Empty input",
-			input:          map[int]Delta{},
-			expectedOutput: map[int]PrettyDelta{},
+			input:          Delta{},
+			expectedOutput: []PrettyOp{},
 		},
 	}
 
@@ -37,3 +39,76 @@ func TestPrettifyDelta(t *testing.T) {
 		})
 	}
 }
+
+func TestDeltaEmitter(t *testing.T) {
+	testCases := []struct {
+		name          string
+		emit          func(e *deltaEmitter)
+		expectedDelta Delta
+	}{
+		{
+			name: "Following Chunks",
+			emit: func(e *deltaEmitter) {
+				e.copyChunk(1)
+				e.copyChunk(2)
+				e.copyChunk(3)
+			},
+			expectedDelta: Delta{Copy(1, 3)},
+		},
+		{
+			name: "Repeated Chunk",
+			emit: func(e *deltaEmitter) {
+				e.copyChunk(1)
+				e.copyChunk(2)
+				e.copyChunk(2)
+			},
+			expectedDelta: Delta{Copy(1, 2), Copy(2, 1)},
+		},
+		{
+			name: "After Literal",
+			emit: func(e *deltaEmitter) {
+				e.copyChunk(0)
+				e.literal([]byte("text")...)
+				e.copyChunk(1)
+			},
+			expectedDelta: Delta{Copy(0, 1), Literal([]byte("text")), Copy(1, 1)},
+		},
+		{
+			name: "Following Ranges",
+			emit: func(e *deltaEmitter) {
+				e.copyRange(10, 5)
+				e.copyRange(15, 7)
+				e.copyRange(0, 10)
+				e.literal('a')
+				e.copyRange(10, 1)
+			},
+			expectedDelta: Delta{CopyRange(10, 12), CopyRange(0, 10), Literal([]byte("a")), CopyRange(10, 1)},
+		},
+		{
+			name: "Consecutive Literals",
+			emit: func(e *deltaEmitter) {
+				e.literal('a', 'b')
+				e.literal()
+				e.literal('c')
+			},
+			expectedDelta: Delta{Literal([]byte("abc"))},
+		},
+		{
+			name: "Literals Over Flush Size",
+			emit: func(e *deltaEmitter) {
+				e.literal([]byte("abcdefghij")...)
+			},
+			expectedDelta: Delta{Literal([]byte("abcd")), Literal([]byte("efgh")), Literal([]byte("ij"))},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var delta Delta
+			emitter := newDeltaEmitter(&delta, 4)
+			tc.emit(emitter)
+			assert.NoError(t, emitter.flush())
+			assert.Equal(t, tc.expectedDelta, delta)
+		})
+	}
+}
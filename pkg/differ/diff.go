@@ -0,0 +1,43 @@
+package differ
+
+import (
+	"context"
+	"io"
+)
+
+// Chunk size of the one-shot Diff and Patch, the default block size of rsync.
+const DefaultChunkSize = MinBlockSize
+
+/*
+Generates the delta of new against old when both are at hand, without going through a signature file.
+The signatures of old are only kept in memory while the delta of new is searched.
+*/
+func (d *Differ) Diff(old, new io.Reader) (Delta, error) {
+	return d.DiffContext(context.Background(), old, new)
+}
+
+// Generates the delta like Diff, and stops with a CanceledError once ctx is done.
+func (d *Differ) DiffContext(ctx context.Context, old, new io.Reader) (Delta, error) {
+	signatures, err := d.GenerateSignaturesContext(ctx, old)
+	if err != nil {
+		return nil, err
+	}
+	var delta Delta
+	if err := d.GenerateDelta(ctx, signatures, new, &delta); err != nil {
+		return nil, err
+	}
+	return delta, nil
+}
+
+// Generates the delta of new against old with DefaultChunkSize and the default hashes. Patch applies it.
+func Diff(old, new io.Reader) (Delta, error) {
+	return New(DefaultChunkSize).Diff(old, new)
+}
+
+/*
+Rebuilds new into out by applying a delta to old. The delta copies chunks of chunkSize bytes, which is DefaultChunkSize
+for a delta generated by Diff and the chunk size of the Differ for one generated by its Diff method.
+*/
+func Patch(old io.ReaderAt, delta Delta, chunkSize int, out io.Writer) error {
+	return New(chunkSize).Apply(old, delta, out)
+}
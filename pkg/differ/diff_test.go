@@ -0,0 +1,74 @@
+package differ
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffAndPatch(t *testing.T) {
+	original, err := os.ReadFile(originalFilePath)
+	assert.NoError(t, err)
+	modified, err := os.ReadFile(modifiedFilePath)
+	assert.NoError(t, err)
+	long := bytes.Repeat(original, 20)
+	longModified := append(append(append([]byte(nil), long[:5000]...), "inserted"...), long[5000:]...)
+
+	testCases := []struct {
+		name string
+		old  []byte
+		new  []byte
+	}{
+		{name: "Test Data", old: original, new: modified},
+		{name: "Reversed Test Data", old: modified, new: original},
+		{name: "Insertion In Long File", old: long, new: longModified},
+		{name: "Empty Old", old: nil, new: modified},
+		{name: "Empty New", old: original, new: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			delta, err := Diff(bytes.NewReader(tc.old), bytes.NewReader(tc.new))
+			assert.NoError(t, err)
+
+			var patched bytes.Buffer
+			assert.NoError(t, Patch(bytes.NewReader(tc.old), delta, DefaultChunkSize, &patched))
+			assert.Equal(t, tc.new, patched.Bytes())
+
+			// A delta of a Differ copies chunks of its own chunk size
+			delta, err = New(16).Diff(bytes.NewReader(tc.old), bytes.NewReader(tc.new))
+			assert.NoError(t, err)
+			patched.Reset()
+			assert.NoError(t, Patch(bytes.NewReader(tc.old), delta, 16, &patched))
+			assert.Equal(t, tc.new, patched.Bytes())
+		})
+	}
+}
+
+func TestDiffMatchesSignaturesAndDelta(t *testing.T) {
+	old := strings.Repeat("This is the old file. ", 50)
+	new := strings.Replace(old, "old", "new", 3)
+
+	differInstance := New(16)
+	delta, err := differInstance.Diff(strings.NewReader(old), strings.NewReader(new))
+	assert.NoError(t, err)
+
+	signatures, err := differInstance.GenerateSignatures(strings.NewReader(old))
+	assert.NoError(t, err)
+	assert.Equal(t, generateDelta(t, differInstance, signatures, []byte(new)), delta)
+}
+
+func TestDiffErrors(t *testing.T) {
+	readErr := errors.New("read failed")
+
+	_, err := Diff(iotest.ErrReader(readErr), strings.NewReader("new"))
+	assert.ErrorIs(t, err, readErr)
+
+	_, err = Diff(strings.NewReader("old"), iotest.ErrReader(readErr))
+	assert.ErrorIs(t, err, readErr)
+}
@@ -2,120 +2,324 @@ package differ
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	gohash "hash"
 	"io"
 
 	"github.com/Psykepro/rdiff/pkg/hash"
-	"github.com/Psykepro/rdiff/pkg/utils"
+)
+
+const (
+	DefaultWeakHash   = hash.Adler32
+	DefaultStrongHash = hash.BLAKE2b
+
+	// Number of literals buffered before they are handed to the sink as one instruction
+	DefaultLiteralFlushSize = 64 << 10
 )
 
 type Differ struct {
-	chunkSize int //ChunkSize in bytes
+	chunkSize    int //ChunkSize in bytes
+	weakHash     hash.WeakHash
+	strongHash   hash.StrongHash
+	strongLength int //Length in bytes the strong hashes are truncated to
+	flushSize    int //Number of literals buffered before they are written as one instruction
+	jobs         int //Number of workers hashing in parallel
+	minChunkSize int //Smallest content-defined chunk, zero for chunks of a fixed size
+	maxChunkSize int //Largest content-defined chunk, zero for chunks of a fixed size
+	segmentSize  int64
+	progress     func(Progress)
 }
 
-func New(chunkSize int) *Differ {
-	return &Differ{chunkSize: chunkSize}
+type Option func(*Differ)
+
+// Selects the rolling hash of the chunks.
+func WithWeakHash(weakHash hash.WeakHash) Option {
+	return func(d *Differ) {
+		d.weakHash = weakHash
+	}
 }
 
-func (d *Differ) GenerateSignatures(reader *bufio.Reader) map[uint]int {
-	//Map of hash to the index of hash
-	signatures := make(map[uint]int)
-	count := 0
-	for {
-		chunk := make([]byte, d.chunkSize)
-		bytes, err := reader.Read(chunk)
-		if bytes == 0 || err == io.EOF {
-			break
+// Selects the strong hash of the chunks and the length its digests are truncated to. Zero length keeps the full digest.
+func WithStrongHash(strongHash hash.StrongHash, length int) Option {
+	return func(d *Differ) {
+		d.strongHash = strongHash
+		d.strongLength = length
+	}
+}
+
+// Sets the number of literals buffered while generating a delta before they are written as one instruction.
+func WithLiteralFlushSize(size int) Option {
+	return func(d *Differ) {
+		d.flushSize = size
+	}
+}
+
+// Sets the number of workers used by the parallel engines, which read the file through an io.ReaderAt.
+func WithJobs(jobs int) Option {
+	return func(d *Differ) {
+		d.jobs = jobs
+	}
+}
+
+/*
+Splits the original file into content-defined chunks of minSize to maxSize bytes instead of chunks of a fixed size.
+The chunk size of the differ becomes the average length of the chunks.
+*/
+func WithContentDefinedChunking(minSize, maxSize int) Option {
+	return func(d *Differ) {
+		d.minChunkSize = minSize
+		d.maxChunkSize = maxSize
+	}
+}
+
+func New(chunkSize int, options ...Option) *Differ {
+	d := &Differ{
+		chunkSize:   chunkSize,
+		weakHash:    DefaultWeakHash,
+		strongHash:  DefaultStrongHash,
+		flushSize:   DefaultLiteralFlushSize,
+		jobs:        1,
+		segmentSize: deltaSegmentSize,
+	}
+	for _, option := range options {
+		option(d)
+	}
+	if d.strongLength <= 0 || d.strongLength > d.strongHash.Size() {
+		d.strongLength = d.strongHash.Size()
+	}
+	if d.flushSize <= 0 {
+		d.flushSize = DefaultLiteralFlushSize
+	}
+	if d.jobs < 1 {
+		d.jobs = 1
+	}
+	if d.maxChunkSize > 0 {
+		d.minChunkSize = min(max(d.minChunkSize, 1), d.chunkSize)
+		d.maxChunkSize = max(d.maxChunkSize, d.chunkSize)
+	}
+	return d
+}
+
+// Creates an empty signature table using the chunk size and hashes of the differ.
+func (d *Differ) NewSignatureTable() *SignatureTable {
+	signatures := NewSignatureTable(d.chunkSize, d.weakHash, d.strongHash, d.strongLength, nil)
+	signatures.MinChunkSize = d.minChunkSize
+	signatures.MaxChunkSize = d.maxChunkSize
+	return signatures
+}
+
+// Generates the signatures of the original file read from reader and collects them in memory, until ctx is done.
+func (d *Differ) GenerateSignaturesContext(ctx context.Context, reader io.Reader) (*SignatureTable, error) {
+	signatures := d.NewSignatureTable()
+	if err := d.StreamSignaturesContext(ctx, reader, signatures); err != nil {
+		return nil, err
+	}
+	return signatures, nil
+}
+
+// Generates the signatures of the original file read from reader and collects them in memory.
+func (d *Differ) GenerateSignatures(reader io.Reader) (*SignatureTable, error) {
+	return d.GenerateSignaturesContext(context.Background(), reader)
+}
+
+/*
+Streams the signatures of the original file read from reader to sink, one chunk at a time. The chunk buffer
+and the hashes are reused for every chunk, so memory stays constant however large the original file is.
+A sink implementing DigestSink also receives the digest of the original file at the end.
+*/
+func (d *Differ) StreamSignatures(reader io.Reader, sink SignatureSink) error {
+	return d.StreamSignaturesContext(context.Background(), reader, sink)
+}
+
+// Streams the signatures like StreamSignatures, and stops with a CanceledError once ctx is done.
+func (d *Differ) StreamSignaturesContext(ctx context.Context, reader io.Reader, sink SignatureSink) error {
+	progress := d.newProgressTracker(StageSignatures, nil)
+	digest := newFileDigest(sink)
+	if digest != nil {
+		reader = io.TeeReader(reader, digest)
+	}
+	err := d.streamSignatures(ctx, reader, progress.signatureSink(sink))
+	if err == nil {
+		err = digest.writeTo(sink)
+	}
+	return progress.finish(err)
+}
+
+func (d *Differ) streamSignatures(ctx context.Context, reader io.Reader, sink SignatureSink) error {
+	if d.maxChunkSize > 0 {
+		return d.streamSignaturesCDC(ctx, reader, sink)
+	}
+	chunk := make([]byte, d.chunkSize)
+	weak := d.weakHash.New(d.chunkSize)
+	strong := d.strongHash.New()
+	strongHash := make([]byte, 0, d.strongHash.Size())
+	var offset int64
+	for index := 0; ; index++ {
+		if err := checkContext(ctx, offset); err != nil {
+			return err
 		}
 		/*
-			If the chunk cannot be filled with the remaining bytes in the file,
-			only pick the slice that is filled
+			A single Read may return fewer bytes than a chunk at any point of the stream, so every chunk
+			is filled completely. Only the last chunk may be shorter, when the file ends in the middle of it.
 		*/
-		if bytes < d.chunkSize {
-			chunk = chunk[:bytes]
+		bytes, err := io.ReadFull(reader, chunk)
+		if err == io.EOF {
+			break
+		}
+		// A short chunk is the explicit end of the file
+		last := err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return NewReadOriginalError(err)
+		}
+		weak.Reset()
+		weak.Write(chunk[:bytes])
+		err = sink.WriteBlock(Block{
+			Index:      index,
+			Offset:     offset,
+			Length:     bytes,
+			WeakHash:   weak.Sum32(),
+			StrongHash: strongSum(strong, strongHash, chunk[:bytes], d.strongLength),
+		})
+		if err != nil {
+			return err
+		}
+		offset += int64(bytes)
+		if last {
+			break
 		}
-		adler32 := hash.NewAdler32(d.chunkSize)
-		adler32.Write(chunk)
-		signature := adler32.Hash()
-		signatures[signature] = count
-		count++
 	}
-	return signatures
+	return nil
 }
 
-func (d *Differ) GenerateDelta(signatures map[uint]int, reader *bufio.Reader) map[int]Delta {
-	// Map of index to Delta struct
-	deltas := make(map[int]Delta)
-	adler32 := hash.NewAdler32(d.chunkSize)
+/*
+Streams the delta of the updated file read from reader against the signatures to sink. Instructions are
+written as soon as they are found, so only a window of one chunk and up to flushSize literals are held in memory.
+A sink implementing DigestSink also receives the length and digest of the updated file at the end.
+*/
+func (d *Differ) GenerateDelta(ctx context.Context, signatures *SignatureTable, reader io.Reader, sink DeltaSink) error {
+	progress := d.newProgressTracker(StageDelta, signatures)
+	digest := newFileDigest(sink)
+	if digest != nil {
+		reader = io.TeeReader(reader, digest)
+	}
+	err := d.generateDelta(ctx, signatures, reader, sink, progress)
+	if err == nil {
+		err = digest.writeTo(sink)
+	}
+	return progress.finish(err)
+}
 
-	var diffingLiterals []byte
-	lastFoundIndex := -1
+// Generates the delta like GenerateDelta, recording its progress in progress, which may be nil.
+func (d *Differ) generateDelta(ctx context.Context, signatures *SignatureTable, reader io.Reader, sink DeltaSink, progress *progressTracker) error {
+	if signatures.ContentDefined() {
+		return d.generateDeltaCDC(ctx, signatures, reader, sink, progress)
+	}
+	buffered := bufio.NewReader(reader)
+	emitter := newDeltaEmitter(sink, d.flushSize)
+	emitter.progress = progress
+	// The chunks are those of the signatures, which may have been generated with another chunk size than the differ's
+	chunkSize := signatures.ChunkSize
+	weak := signatures.WeakHash.New(chunkSize)
+	strong := signatures.StrongHash.New()
 
+	var processed int64
 	for {
-		c, err := reader.ReadByte()
-		if err == io.EOF || err != nil {
+		// The context is checked once per chunk, so that cancelling stays cheap
+		if processed%int64(chunkSize) == 0 {
+			if err := checkContext(ctx, processed); err != nil {
+				return err
+			}
+			progress.read(processed)
+		}
+		c, err := buffered.ReadByte()
+		if err == io.EOF {
 			break
 		}
-		hash := adler32.RollIn(c)
-		if adler32.WindowLength() < d.chunkSize {
-			//Check if this is not the last byte before continuing
-			if next, _ := reader.Peek(1); len(next) > 0 {
-				continue
+		if err != nil {
+			return NewReadUpdatedError(err)
+		}
+		processed++
+		if len(weak.Window()) == chunkSize {
+			// The full window did not match when it was checked, so its first byte becomes a literal
+			out := weak.Window()[0]
+			weak.Roll(out, c)
+			if err := emitter.literal(out); err != nil {
+				return err
+			}
+		} else {
+			weak.RollIn(c)
+			if len(weak.Window()) < chunkSize {
+				//Check if this is not the last byte before continuing
+				next, err := buffered.Peek(1)
+				if len(next) > 0 {
+					continue
+				}
+				if err != io.EOF {
+					return NewReadUpdatedError(err)
+				}
 			}
 		}
-		index := findIndex(signatures, hash)
-
-		if index != -1 {
-			adler32.Reset()
-			deltas[index] = Delta{
-				StartIndex:      (index-1)*d.chunkSize + 1,
-				EndIndex:        (index) * d.chunkSize,
-				Deleted:         false,
-				UpdatedLiterals: diffingLiterals,
+		if index := findIndex(signatures, weak.Sum32(), weak.Window(), strong, emitter.next()); index != -1 {
+			weak.Reset()
+			if err := emitter.copyChunk(index); err != nil {
+				return err
 			}
-			utils.Clear(&diffingLiterals)
-			lastFoundIndex = index
-			continue
 		}
-		_, removed := adler32.RollOut()
-		diffingLiterals = append(diffingLiterals, removed)
-	}
-	if len(diffingLiterals) > 0 {
-		diffingLiterals = append(diffingLiterals, adler32.GetWindowLiterals()...)
-		deltas[lastFoundIndex+1] = Delta{
-			StartIndex:      (lastFoundIndex + 1) * d.chunkSize,
-			EndIndex:        (lastFoundIndex + 2) * d.chunkSize,
-			Deleted:         false,
-			UpdatedLiterals: diffingLiterals,
+	}
+	/*
+		The window was already checked when its last byte was read. At the end of the file it shrinks
+		from the start instead, so that its tail can still match the short last chunk.
+	*/
+	for len(weak.Window()) > 0 {
+		if err := emitter.literal(weak.RollOut()); err != nil {
+			return err
+		}
+		if index := findIndex(signatures, weak.Sum32(), weak.Window(), strong, emitter.next()); index != -1 {
+			weak.Reset()
+			if err := emitter.copyChunk(index); err != nil {
+				return err
+			}
+			break
 		}
 	}
-	//Update the indexes of chunks that are not found
-	deltas = d.updateDeletedChunks(signatures, deltas)
-	return deltas
+	progress.read(processed)
+	return emitter.flush()
 }
 
-func (d *Differ) updateDeletedChunks(signatures map[uint]int, delta map[int]Delta) map[int]Delta {
-	for _, index := range signatures {
-		if value, ok := delta[index]; !ok {
-			delta[index] = Delta{
-				StartIndex:      (index)*d.chunkSize + 1,
-				EndIndex:        (index + 1) * d.chunkSize,
-				Deleted:         true,
-				UpdatedLiterals: []byte{},
-			}
-		} else if len(value.UpdatedLiterals) == 0 {
-			/*
-				If chunk is found and has no changes surronding it, then delete that entry from the map
-				since we only need to present the diffing part
-			*/
-			delete(delta, index)
+/*
+Picks the chunk matching the window among all chunks with the same weak hash. Weak hashes can collide,
+so the match is only accepted when the strong hashes are equal too. The chunk following the last copied
+one is tried first, so that runs of identical chunks are copied in order, and otherwise the first matching
+chunk is picked. Neither goes through all candidates, which files of many identical chunks have plenty of.
+*/
+func findIndex(signatures *SignatureTable, hash uint32, window []byte, strong gohash.Hash, next int) int {
+	var windowStrongHash []byte
+	matches := func(block *Block) bool {
+		if block.WeakHash != hash || block.Length != len(window) {
+			return false
 		}
+		// The strong hash is expensive, so it is calculated only once a weak hash matches
+		if windowStrongHash == nil {
+			windowStrongHash = strongSum(strong, nil, window, signatures.StrongLength)
+		}
+		return bytes.Equal(block.StrongHash, windowStrongHash)
 	}
-	return delta
-}
 
-func findIndex(signatures map[uint]int, hash uint) int {
-	if index, found := signatures[hash]; found {
-		return index
+	if next >= 0 && next < len(signatures.Blocks) && matches(&signatures.Blocks[next]) {
+		return next
+	}
+	for _, position := range signatures.Lookup(hash) {
+		if block := &signatures.Blocks[position]; matches(block) {
+			return block.Index
+		}
 	}
 	return -1
 }
+
+// Calculates the strong hash of data truncated to length, reusing the buffer of dst.
+func strongSum(strong gohash.Hash, dst, data []byte, length int) []byte {
+	strong.Reset()
+	strong.Write(data)
+	return strong.Sum(dst[:0])[:length]
+}
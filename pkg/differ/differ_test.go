@@ -3,6 +3,9 @@ package differ
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,60 +16,69 @@ func TestDiffer(t *testing.T) {
 		name           string
 		txt1           string
 		txt2           string
-		expectedDeltas map[int]PrettyDelta
+		expectedDeltas []PrettyOp
 	}{
 		{
 			name: "Chunk Change",
 			txt1: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
 			txt2: "This is a Rolling hashes file difference algorithm. It should check for changes in file and text",
-			expectedDeltas: map[int]PrettyDelta{
-				1: {startIndex: 17, endIndex: 32, deleted: true},
-				2: {startIndex: 17, endIndex: 32, updatedLiterals: "g hashes file difference"},
+			expectedDeltas: []PrettyOp{
+				{op: "COPY", blockIndex: 0, count: 1},
+				{op: "LITERAL", literals: "g hashes file difference"},
+				{op: "COPY", blockIndex: 2, count: 4},
 			},
 		},
 		{
 			name: "Chunk Deletion",
 			txt1: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
 			txt2: "This is a Rolling hash file diff algorithm. It should check for changes",
-			expectedDeltas: map[int]PrettyDelta{
-				4: {startIndex: 64, endIndex: 80, updatedLiterals: "changes"},
-				5: {startIndex: 81, endIndex: 96, deleted: true},
+			expectedDeltas: []PrettyOp{
+				{op: "COPY", blockIndex: 0, count: 4},
+				{op: "LITERAL", literals: "changes"},
 			},
 		},
 		{
 			name: "Chunk Addition",
 			txt1: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
 			txt2: "This is a Rolling hash file diff algorithm. It should check for changes in file and text. This is written in a way to detect addition to the text",
-			expectedDeltas: map[int]PrettyDelta{
-				5: {startIndex: 80, endIndex: 96, updatedLiterals: "and text. This is written in a way to detect addition to the text"},
+			expectedDeltas: []PrettyOp{
+				{op: "COPY", blockIndex: 0, count: 5},
+				{op: "LITERAL", literals: "and text. This is written in a way to detect addition to the text"},
 			},
 		},
 		{
-			name:           "No Changes",
-			txt1:           "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
-			txt2:           "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
-			expectedDeltas: map[int]PrettyDelta{},
+			name: "Chunks Moved And Repeated",
+			txt1: "First chunk ****Second chunk ***",
+			txt2: "Second chunk ***First chunk ****First chunk ****",
+			expectedDeltas: []PrettyOp{
+				{op: "COPY", blockIndex: 1, count: 1},
+				{op: "COPY", blockIndex: 0, count: 1},
+				{op: "COPY", blockIndex: 0, count: 1},
+			},
+		},
+		{
+			name: "No Changes",
+			txt1: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
+			txt2: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
+			expectedDeltas: []PrettyOp{
+				{op: "COPY", blockIndex: 0, count: 6},
+			},
 		},
 		{
 			name: "First Chunk Change",
 			txt1: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
 			txt2: "The a Rolling hash file diff algorithm. It should check for changes in file and text",
-			expectedDeltas: map[int]PrettyDelta{
-				0: {startIndex: 1, endIndex: 16, deleted: true},
-				1: {startIndex: 1, endIndex: 16, updatedLiterals: "The a Rollin"},
+			expectedDeltas: []PrettyOp{
+				{op: "LITERAL", literals: "The a Rollin"},
+				{op: "COPY", blockIndex: 1, count: 5},
 			},
 		},
 		{
 			name: "All Chunks Change",
 			txt1: "This is a Rolling hash file diff algorithm. It should check for changes in file and text",
 			txt2: "This is a different text and it is different from all the chunks above",
-			expectedDeltas: map[int]PrettyDelta{
-				0: {startIndex: 0, endIndex: 16, updatedLiterals: "This is a different text and it is different from all the chunks above"},
-				1: {startIndex: 17, endIndex: 32, deleted: true},
-				2: {startIndex: 33, endIndex: 48, deleted: true},
-				3: {startIndex: 49, endIndex: 64, deleted: true},
-				4: {startIndex: 65, endIndex: 80, deleted: true},
-				5: {startIndex: 81, endIndex: 96, deleted: true},
+			expectedDeltas: []PrettyOp{
+				{op: "LITERAL", literals: "This is a different text and it is different from all the chunks above"},
 			},
 		},
 	}
@@ -77,14 +89,208 @@ func TestDiffer(t *testing.T) {
 			reader1 := bytes.NewReader([]byte(tc.txt1))
 			buffReader1 := bufio.NewReader(reader1)
 
-			reader2 := bytes.NewReader([]byte(tc.txt2))
-			buffReader2 := bufio.NewReader(reader2)
-
-			signatures := differInstance.GenerateSignatures(buffReader1)
-			deltas := differInstance.GenerateDelta(signatures, buffReader2)
+			signatures, err := differInstance.GenerateSignatures(buffReader1)
+			assert.NoError(t, err)
+			deltas := generateDelta(t, differInstance, signatures, []byte(tc.txt2))
 			prettyDelta := PrettifyDelta(deltas)
 
 			assert.Equal(t, tc.expectedDeltas, prettyDelta)
 		})
 	}
 }
+
+func TestGenerateDeltaLiteralFlushSize(t *testing.T) {
+	original := []byte("This is a Rolling hash file diff algorithm. It should check for changes in file and text")
+	updated := []byte("This is a different text and it is different from all the chunks above")
+
+	differInstance := New(16, WithLiteralFlushSize(32))
+	signatures, err := differInstance.GenerateSignatures(bufio.NewReader(bytes.NewReader(original)))
+	assert.NoError(t, err)
+	delta := generateDelta(t, differInstance, signatures, updated)
+
+	assert.Len(t, delta, 3)
+	for _, op := range delta {
+		assert.LessOrEqual(t, len(op.Data), 32)
+	}
+	assert.Equal(t, updated, roundTrip(t, differInstance, original, updated))
+}
+
+func TestGenerateDeltaSinkError(t *testing.T) {
+	errSink := errors.New("sink failed")
+	differInstance := New(16)
+	signatures, err := differInstance.GenerateSignatures(bufio.NewReader(bytes.NewReader([]byte("First chunk ****Second chunk ***"))))
+	assert.NoError(t, err)
+
+	var written int
+	sink := sinkFunc(func(op Op) error {
+		written++
+		return errSink
+	})
+	err = differInstance.GenerateDelta(context.Background(), signatures, strings.NewReader("Second chunk ***changed chunk ***"), sink)
+	assert.ErrorIs(t, err, errSink)
+	assert.Equal(t, 1, written)
+}
+
+func TestGenerateDeltaCancelled(t *testing.T) {
+	differInstance := New(16)
+	signatures, err := differInstance.GenerateSignatures(bufio.NewReader(bytes.NewReader([]byte("First chunk ****Second chunk ***"))))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var delta Delta
+	err = differInstance.GenerateDelta(ctx, signatures, strings.NewReader("Second chunk ***"), &delta)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, delta)
+}
+
+func TestCancellation(t *testing.T) {
+	original := []byte(strings.Repeat("This is the original file. ", 100))
+	updated := []byte(strings.Repeat("This is the updated file. ", 100))
+	differInstance := New(16, WithJobs(2))
+	signatures, err := differInstance.GenerateSignatures(bytes.NewReader(original))
+	assert.NoError(t, err)
+	delta := generateDelta(t, differInstance, signatures, updated)
+
+	// Cancels the context once the sink has received blocks or instructions covering 64 bytes
+	cancelAfter := func(cancel context.CancelFunc) (SignatureSink, DeltaSink) {
+		var received int
+		return blockSinkFunc(func(block Block) error {
+				if received += block.Length; received >= 64 {
+					cancel()
+				}
+				return nil
+			}), sinkFunc(func(op Op) error {
+				if received += len(op.Data) + op.Count*16; received >= 64 {
+					cancel()
+				}
+				return nil
+			})
+	}
+
+	testCases := []struct {
+		name              string
+		run               func(ctx context.Context, signatureSink SignatureSink, deltaSink DeltaSink) error
+		expectedProcessed int64
+	}{
+		{
+			name: "StreamSignaturesContext",
+			run: func(ctx context.Context, signatureSink SignatureSink, _ DeltaSink) error {
+				return differInstance.StreamSignaturesContext(ctx, bytes.NewReader(original), signatureSink)
+			},
+			expectedProcessed: 64,
+		},
+		{
+			name: "GenerateSignaturesContext",
+			run: func(ctx context.Context, _ SignatureSink, _ DeltaSink) error {
+				ctx, cancel := context.WithTimeout(ctx, -1)
+				defer cancel()
+				_, err := differInstance.GenerateSignaturesContext(ctx, bytes.NewReader(original))
+				return err
+			},
+			expectedProcessed: 0,
+		},
+		{
+			name: "StreamSignaturesAtContext",
+			run: func(ctx context.Context, _ SignatureSink, _ DeltaSink) error {
+				ctx, cancel := context.WithCancel(ctx)
+				cancel()
+				return differInstance.StreamSignaturesAtContext(ctx, bytes.NewReader(original), int64(len(original)), differInstance.NewSignatureTable())
+			},
+			expectedProcessed: 0,
+		},
+		{
+			name: "GenerateDelta",
+			run: func(ctx context.Context, _ SignatureSink, deltaSink DeltaSink) error {
+				// Nothing matches, so the literals trail the bytes read by the window of one chunk
+				unrelated := bytes.Repeat([]byte("0123456789"), 50)
+				return New(16, WithLiteralFlushSize(16)).GenerateDelta(ctx, signatures, bytes.NewReader(unrelated), deltaSink)
+			},
+			expectedProcessed: 80,
+		},
+		{
+			name: "ApplyContext",
+			run: func(ctx context.Context, _ SignatureSink, _ DeltaSink) error {
+				ctx, cancel := context.WithCancel(ctx)
+				writer := writerFunc(func(p []byte) (int, error) {
+					cancel()
+					return len(p), nil
+				})
+				return differInstance.ApplyContext(ctx, bytes.NewReader(original), delta, writer)
+			},
+			expectedProcessed: int64(len(delta[0].Data)) + int64(delta[0].Count)*16,
+		},
+		{
+			name: "DiffContext",
+			run: func(ctx context.Context, _ SignatureSink, _ DeltaSink) error {
+				ctx, cancel := context.WithCancel(ctx)
+				cancel()
+				_, err := differInstance.DiffContext(ctx, bytes.NewReader(original), bytes.NewReader(updated))
+				return err
+			},
+			expectedProcessed: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			signatureSink, deltaSink := cancelAfter(cancel)
+
+			err := tc.run(ctx, signatureSink, deltaSink)
+			var canceled *CanceledError
+			if assert.ErrorAs(t, err, &canceled) {
+				assert.Equal(t, tc.expectedProcessed, canceled.Processed)
+			}
+			assert.True(t, errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded))
+		})
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+type sinkFunc func(op Op) error
+
+func (f sinkFunc) WriteOp(op Op) error {
+	return f(op)
+}
+
+// generateDelta generates the delta of updated against the signatures and collects it in memory.
+func generateDelta(t *testing.T, differInstance *Differ, signatures *SignatureTable, updated []byte) Delta {
+	var delta Delta
+	err := differInstance.GenerateDelta(context.Background(), signatures, bytes.NewReader(updated), &delta)
+	assert.NoError(t, err)
+	return delta
+}
+
+func TestGenerateDeltaSignatureChunkSize(t *testing.T) {
+	original := []byte(strings.Repeat("The chunk size comes from the signatures. ", 32))
+	updated := append([]byte("A new beginning. "), original[100:]...)
+	signatures, err := New(64).GenerateSignatures(bytes.NewReader(original))
+	assert.NoError(t, err)
+
+	// A differ with another chunk size still searches the chunks of the signatures
+	differInstance := New(16, WithJobs(2))
+	differInstance.segmentSize = 200
+	var delta, parallelDelta Delta
+	assert.NoError(t, differInstance.GenerateDelta(context.Background(), signatures, bytes.NewReader(updated), &delta))
+	assert.NoError(t, differInstance.GenerateDeltaAt(context.Background(), signatures, bytes.NewReader(updated), int64(len(updated)), &parallelDelta))
+
+	for _, delta := range []Delta{delta, parallelDelta} {
+		copied := 0
+		for _, op := range delta {
+			if op.Type == OpCopy {
+				copied += op.Count
+			}
+		}
+		assert.NotZero(t, copied)
+		var patched bytes.Buffer
+		assert.NoError(t, New(64).Apply(bytes.NewReader(original), delta, &patched))
+		assert.Equal(t, updated, patched.Bytes())
+	}
+}
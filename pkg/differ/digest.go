@@ -0,0 +1,43 @@
+package differ
+
+import (
+	"crypto/sha256"
+	gohash "hash"
+)
+
+/*
+Implemented by signature and delta sinks recording the length and SHA-256 digest of the whole file they describe,
+the original file for signatures and the updated file for a delta. WriteDigest is called once, after the last
+chunk or instruction, and the digest is only calculated for sinks implementing it. Signature sinks may ignore
+the length, which follows from their chunks.
+*/
+type DigestSink interface {
+	WriteDigest(length int64, digest []byte) error
+}
+
+// Length and SHA-256 digest of everything written to it, which is everything read from the file a sink describes.
+type fileDigest struct {
+	length int64
+	hash   gohash.Hash
+}
+
+// Returns nil when sink does not record the digest, so that it is not calculated for nothing.
+func newFileDigest(sink any) *fileDigest {
+	if _, ok := sink.(DigestSink); !ok {
+		return nil
+	}
+	return &fileDigest{hash: sha256.New()}
+}
+
+func (f *fileDigest) Write(p []byte) (int, error) {
+	f.length += int64(len(p))
+	return f.hash.Write(p)
+}
+
+// Hands the length and digest to sink once the whole file was read. A nil digest does nothing.
+func (f *fileDigest) writeTo(sink any) error {
+	if f == nil {
+		return nil
+	}
+	return sink.(DigestSink).WriteDigest(f.length, f.hash.Sum(nil))
+}
@@ -0,0 +1,65 @@
+package differ
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Collects the delta and the digest handed to it.
+type digestDelta struct {
+	Delta
+	length int64
+	digest []byte
+}
+
+func (d *digestDelta) WriteDigest(length int64, digest []byte) error {
+	d.length, d.digest = length, digest
+	return nil
+}
+
+func TestDigest(t *testing.T) {
+	random := rand.New(rand.NewSource(5))
+	original := make([]byte, 3*signatureBatchSize+123)
+	random.Read(original)
+	updated := append([]byte("inserted"), original[1000:]...)
+	originalDigest := sha256.Sum256(original)
+	updatedDigest := sha256.Sum256(updated)
+
+	for _, jobs := range []int{1, 4} {
+		differInstance := New(1024, WithJobs(jobs))
+		differInstance.segmentSize = 100000
+
+		signatures, err := differInstance.GenerateSignatures(bytes.NewReader(original))
+		assert.NoError(t, err)
+		assert.Equal(t, originalDigest[:], signatures.Digest)
+
+		streamed := differInstance.NewSignatureTable()
+		assert.NoError(t, differInstance.StreamSignaturesAt(bytes.NewReader(original), int64(len(original)), streamed))
+		assert.Equal(t, originalDigest[:], streamed.Digest, "%d jobs", jobs)
+
+		var sequential digestDelta
+		assert.NoError(t, differInstance.GenerateDelta(context.Background(), signatures, bytes.NewReader(updated), &sequential))
+		assert.Equal(t, int64(len(updated)), sequential.length)
+		assert.Equal(t, updatedDigest[:], sequential.digest)
+
+		var parallel digestDelta
+		assert.NoError(t, differInstance.GenerateDeltaAt(context.Background(), signatures, bytes.NewReader(updated), int64(len(updated)), &parallel))
+		assert.Equal(t, int64(len(updated)), parallel.length)
+		assert.Equal(t, updatedDigest[:], parallel.digest, "%d jobs", jobs)
+	}
+}
+
+func TestDigestContentDefined(t *testing.T) {
+	original := bytes.Repeat([]byte("content-defined chunks of the original file "), 500)
+	differInstance := New(64, WithContentDefinedChunking(16, 256), WithJobs(4))
+
+	signatures := differInstance.NewSignatureTable()
+	assert.NoError(t, differInstance.StreamSignaturesAt(bytes.NewReader(original), int64(len(original)), signatures))
+	digest := sha256.Sum256(original)
+	assert.Equal(t, digest[:], signatures.Digest)
+}
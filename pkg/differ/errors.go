@@ -0,0 +1,51 @@
+package differ
+
+import (
+	"context"
+	"fmt"
+)
+
+/*
+Returned when reading one of the files fails before its end. The end of a file is never an error, while a
+file ending earlier than the signatures or the delta expect is reported as io.ErrUnexpectedEOF. Errors of
+the sinks and writers handed to the differ are returned as they are.
+*/
+var (
+	ErrReadOriginal = fmt.Errorf("error in reading original file")
+	ErrReadUpdated  = fmt.Errorf("error in reading updated file")
+)
+
+// The cause stays in the chain, so that errors.Is matches both ErrReadOriginal and err.
+func NewReadOriginalError(err error) error {
+	return fmt.Errorf("%w. Error Details: %w", ErrReadOriginal, err)
+}
+
+func NewReadUpdatedError(err error) error {
+	return fmt.Errorf("%w. Error Details: %w", ErrReadUpdated, err)
+}
+
+/*
+Returned when the context of an operation is cancelled or its deadline passes. Processed is the number of
+bytes of the input handled before stopping. It unwraps to the error of the context, so errors.Is still
+matches context.Canceled and context.DeadlineExceeded.
+*/
+type CanceledError struct {
+	Processed int64
+	Err       error
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("%v after %d bytes", e.Err, e.Processed)
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// Returns a CanceledError once ctx is done. It is checked at chunk boundaries, so that cancelling stays cheap.
+func checkContext(ctx context.Context, processed int64) error {
+	if err := ctx.Err(); err != nil {
+		return &CanceledError{Processed: processed, Err: err}
+	}
+	return nil
+}
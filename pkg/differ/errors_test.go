@@ -0,0 +1,160 @@
+package differ
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Reads data, then fails with err instead of reaching the end of the file.
+func failingReader(data []byte, err error) io.Reader {
+	return io.MultiReader(bytes.NewReader(data), iotest.ErrReader(err))
+}
+
+// ReaderAt failing with err from offset on.
+type failingReaderAt struct {
+	data   []byte
+	offset int64
+	err    error
+}
+
+func (r failingReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	if offset+int64(len(p)) > r.offset {
+		return 0, r.err
+	}
+	return copy(p, r.data[offset:]), nil
+}
+
+func TestReadErrors(t *testing.T) {
+	errDisk := errors.New("input/output error")
+	original := bytes.Repeat([]byte("0123456789abcdef"), 100)
+	differInstance := New(16, WithJobs(2))
+	signatures, err := differInstance.GenerateSignatures(bytes.NewReader(original))
+	assert.NoError(t, err)
+	cdcDiffer := New(64, WithContentDefinedChunking(16, 256))
+	cdcSignatures, err := cdcDiffer.GenerateSignatures(bytes.NewReader(original))
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		run         func() error
+		expectedErr error
+		cause       error
+	}{
+		{
+			name: "Signatures",
+			run: func() error {
+				_, err := differInstance.GenerateSignatures(failingReader(original[:100], errDisk))
+				return err
+			},
+			expectedErr: ErrReadOriginal,
+			cause:       errDisk,
+		},
+		{
+			name: "Content-Defined Signatures",
+			run: func() error {
+				_, err := cdcDiffer.GenerateSignatures(failingReader(original[:100], errDisk))
+				return err
+			},
+			expectedErr: ErrReadOriginal,
+			cause:       errDisk,
+		},
+		{
+			name: "Parallel Signatures",
+			run: func() error {
+				reader := failingReaderAt{data: original, offset: 100, err: errDisk}
+				return differInstance.StreamSignaturesAt(reader, int64(len(original)), differInstance.NewSignatureTable())
+			},
+			expectedErr: ErrReadOriginal,
+			cause:       errDisk,
+		},
+		{
+			name: "Delta",
+			run: func() error {
+				return differInstance.GenerateDelta(context.Background(), signatures, failingReader(original[:100], errDisk), &Delta{})
+			},
+			expectedErr: ErrReadUpdated,
+			cause:       errDisk,
+		},
+		{
+			name: "Delta Failing Before A Whole Chunk",
+			run: func() error {
+				return differInstance.GenerateDelta(context.Background(), signatures, failingReader(original[:7], errDisk), &Delta{})
+			},
+			expectedErr: ErrReadUpdated,
+			cause:       errDisk,
+		},
+		{
+			name: "Content-Defined Delta",
+			run: func() error {
+				return cdcDiffer.GenerateDelta(context.Background(), cdcSignatures, failingReader(original[:100], errDisk), &Delta{})
+			},
+			expectedErr: ErrReadUpdated,
+			cause:       errDisk,
+		},
+		{
+			name: "Parallel Delta Of A Truncated File",
+			run: func() error {
+				return differInstance.GenerateDeltaAt(context.Background(), signatures, bytes.NewReader(original[:500]), int64(len(original)), &Delta{})
+			},
+			expectedErr: ErrReadUpdated,
+			cause:       io.ErrUnexpectedEOF,
+		},
+		{
+			name: "Apply To A Truncated Original",
+			run: func() error {
+				return differInstance.Apply(bytes.NewReader(original[:40]), Delta{Copy(0, 4)}, io.Discard)
+			},
+			expectedErr: ErrReadOriginal,
+			cause:       io.ErrUnexpectedEOF,
+		},
+		{
+			name: "Apply A Range Past The Original",
+			run: func() error {
+				return differInstance.Apply(bytes.NewReader(original[:40]), Delta{CopyRange(30, 20)}, io.Discard)
+			},
+			expectedErr: ErrReadOriginal,
+			cause:       io.ErrUnexpectedEOF,
+		},
+		{
+			name: "Apply With A Failing Original",
+			run: func() error {
+				reader := failingReaderAt{data: original, offset: 16, err: errDisk}
+				return differInstance.Apply(reader, Delta{Copy(0, 4)}, io.Discard)
+			},
+			expectedErr: ErrReadOriginal,
+			cause:       errDisk,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.run()
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.ErrorIs(t, err, tc.cause)
+		})
+	}
+}
+
+func TestApplyWriteError(t *testing.T) {
+	errFull := errors.New("no space left on device")
+	differInstance := New(16)
+	out := writerFunc(func([]byte) (int, error) { return 0, errFull })
+
+	err := differInstance.Apply(bytes.NewReader(make([]byte, 64)), Delta{Copy(0, 4)}, out)
+	assert.ErrorIs(t, err, errFull)
+	assert.NotErrorIs(t, err, ErrReadOriginal)
+}
+
+func TestApplyShortLastChunk(t *testing.T) {
+	// The last chunk of the original file is shorter than the others, which is not a truncation
+	original := []byte("0123456789abcdef012")
+	var patched bytes.Buffer
+	assert.NoError(t, New(16).Apply(bytes.NewReader(original), Delta{Copy(0, 2)}, &patched))
+	assert.Equal(t, original, patched.Bytes())
+}
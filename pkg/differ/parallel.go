@@ -0,0 +1,280 @@
+package differ
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+const (
+	// Number of bytes hashed at once by a worker of the parallel signatures, rounded down to whole chunks
+	signatureBatchSize = 1 << 20
+	// Number of bytes of the updated file searched by a worker of the parallel delta, besides the overlap with the next segment
+	deltaSegmentSize = 8 << 20
+)
+
+// Chunks of one range of the original file, hashed by a single worker, along with the data of the range.
+type signatureBatch struct {
+	blocks []Block
+	data   []byte
+	buffer *[]byte // Holds data, and goes back to the pool once the range is consumed
+	err    error
+}
+
+/*
+Generates the signatures of the first size bytes of reader with a pool of workers, one per job. The file is
+split into ranges of whole chunks which are hashed independently, and the chunks are handed to sink in
+order, so the signatures are identical to the ones of StreamSignatures. Only a few ranges per worker are
+held in memory at any time. The ranges are also handed over in order to calculate the digest for a DigestSink,
+so the original file is only read once.
+*/
+func (d *Differ) StreamSignaturesAt(reader io.ReaderAt, size int64, sink SignatureSink) error {
+	return d.StreamSignaturesAtContext(context.Background(), reader, size, sink)
+}
+
+// Generates the signatures like StreamSignaturesAt, and stops with a CanceledError once ctx is done.
+func (d *Differ) StreamSignaturesAtContext(ctx context.Context, reader io.ReaderAt, size int64, sink SignatureSink) error {
+	// Where a content-defined chunk ends depends on where the previous one ended, so they are found in order
+	if d.maxChunkSize > 0 {
+		return d.StreamSignaturesContext(ctx, io.NewSectionReader(reader, 0, size), sink)
+	}
+	progress := d.newProgressTracker(StageSignatures, nil)
+	digest := newFileDigest(sink)
+	err := d.streamSignaturesAt(ctx, reader, size, progress.signatureSink(sink), digest)
+	if err == nil {
+		err = digest.writeTo(sink)
+	}
+	return progress.finish(err)
+}
+
+// Generates the signatures like StreamSignaturesAt, writing the original file in order to digest when it is not nil.
+func (d *Differ) streamSignaturesAt(ctx context.Context, reader io.ReaderAt, size int64, sink SignatureSink, digest *fileDigest) error {
+	batchChunks := max(1, signatureBatchSize/d.chunkSize)
+	batchSize := int64(batchChunks) * int64(d.chunkSize)
+	batches := int((size + batchSize - 1) / batchSize)
+
+	buffers := &sync.Pool{New: func() any {
+		buffer := make([]byte, batchSize)
+		return &buffer
+	}}
+	newWorker := func() func(batch int) signatureBatch {
+		return d.newRangeHasher(reader, size, batchSize, batchChunks, buffers)
+	}
+	var processed int64
+	return runOrdered(d.jobs, batches, newWorker, func(batch signatureBatch) error {
+		if err := checkContext(ctx, processed); err != nil {
+			return err
+		}
+		if batch.err != nil {
+			return batch.err
+		}
+		if digest != nil {
+			digest.Write(batch.data)
+		}
+		buffers.Put(batch.buffer)
+		processed += min(batchSize, size-processed)
+		for _, block := range batch.blocks {
+			if err := sink.WriteBlock(block); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+/*
+Returns a function hashing the chunks of one range. The hashes are reused, and the range is read into a buffer
+taken from buffers, which the consumer puts back. Only the resulting blocks are allocated.
+*/
+func (d *Differ) newRangeHasher(reader io.ReaderAt, size, batchSize int64, batchChunks int, buffers *sync.Pool) func(batch int) signatureBatch {
+	weak := d.weakHash.New(d.chunkSize)
+	strong := d.strongHash.New()
+	return func(batch int) signatureBatch {
+		offset := int64(batch) * batchSize
+		buffer := buffers.Get().(*[]byte)
+		data := (*buffer)[:min(batchSize, size-offset)]
+		if n, err := reader.ReadAt(data, offset); n < len(data) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return signatureBatch{err: NewReadOriginalError(err)}
+		}
+
+		blocks := make([]Block, 0, (len(data)+d.chunkSize-1)/d.chunkSize)
+		for start := 0; start < len(data); start += d.chunkSize {
+			chunk := data[start:min(start+d.chunkSize, len(data))]
+			weak.Reset()
+			weak.Write(chunk)
+			blocks = append(blocks, Block{
+				Index:      batch*batchChunks + len(blocks),
+				Offset:     offset + int64(start),
+				Length:     len(chunk),
+				WeakHash:   weak.Sum32(),
+				StrongHash: strongSum(strong, nil, chunk, d.strongLength),
+			})
+		}
+		return signatureBatch{blocks: blocks, data: data, buffer: buffer}
+	}
+}
+
+// Delta of one segment of the updated file, found by a single worker, along with the data of the segment.
+type deltaSegment struct {
+	delta  Delta
+	data   []byte  // Data of the segment without the overlap
+	buffer *[]byte // Holds data, and goes back to the pool once the segment is consumed
+	err    error
+}
+
+/*
+Generates the delta of the first size bytes of reader against the signatures with a pool of workers, one per
+job. The updated file is split into segments which are searched independently, each one overlapping the next
+by one chunk so that chunks crossing the border between two segments are still found. The instructions of the
+segments are then stitched back together and handed to sink in order. The delta rebuilds the same updated file
+as the one of GenerateDelta, and only differs from it around the borders of the segments. Every worker reads its
+segment into memory, and the segments are also handed over in order to calculate the digest for a DigestSink,
+so the updated file is only read once.
+*/
+func (d *Differ) GenerateDeltaAt(ctx context.Context, signatures *SignatureTable, reader io.ReaderAt, size int64, sink DeltaSink) error {
+	// Content-defined chunks are only looked up where they end, which is already cheap enough to do in order
+	if signatures.ContentDefined() {
+		return d.GenerateDelta(ctx, signatures, io.NewSectionReader(reader, 0, size), sink)
+	}
+	chunkSize := signatures.ChunkSize
+	// A segment has to be longer than its overlap, so that every segment moves the stitched delta forward
+	segmentSize := max(d.segmentSize, 2*int64(chunkSize))
+	segments := int((size + segmentSize - 1) / segmentSize)
+	progress := d.newProgressTracker(StageDelta, signatures)
+	digest := newFileDigest(sink)
+	stitcher := &deltaStitcher{
+		emitter:     newDeltaEmitter(sink, d.flushSize),
+		signatures:  signatures,
+		reader:      reader,
+		size:        size,
+		segmentSize: segmentSize,
+	}
+
+	buffers := &sync.Pool{New: func() any {
+		buffer := make([]byte, segmentSize+int64(chunkSize)-1)
+		return &buffer
+	}}
+	newWorker := func() func(segment int) deltaSegment {
+		return func(segment int) deltaSegment {
+			start := int64(segment) * segmentSize
+			end := min(start+segmentSize+int64(chunkSize)-1, size)
+			buffer := buffers.Get().(*[]byte)
+			data := (*buffer)[:end-start]
+			if n, err := reader.ReadAt(data, start); n < len(data) {
+				if err == nil || err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return deltaSegment{buffer: buffer, err: NewReadUpdatedError(err)}
+			}
+			var delta Delta
+			err := d.generateDelta(ctx, signatures, bytes.NewReader(data), &delta, nil)
+			return deltaSegment{delta: delta, data: data[:min(segmentSize, end-start)], buffer: buffer, err: err}
+		}
+	}
+	stitcher.emitter.progress = progress
+	err := runOrdered(d.jobs, segments, newWorker, func(segment deltaSegment) error {
+		defer buffers.Put(segment.buffer)
+		if segment.err != nil {
+			return segment.err
+		}
+		if digest != nil {
+			digest.Write(segment.data)
+		}
+		if err := stitcher.add(segment.delta); err != nil {
+			return err
+		}
+		progress.read(stitcher.covered)
+		return nil
+	})
+	// A segment only knows how far it got itself, while the whole delta is complete up to what was stitched
+	var canceled *CanceledError
+	if errors.As(err, &canceled) {
+		canceled.Processed = stitcher.covered
+	}
+	if err == nil {
+		err = stitcher.emitter.flush()
+	}
+	if err == nil {
+		err = digest.writeTo(sink)
+	}
+	return progress.finish(err)
+}
+
+/*
+Joins the deltas of consecutive segments. Every segment covers the updated file from where it starts until
+where the next one starts, plus the overlap. Its instructions are kept until the end of the segment, where a
+copied chunk may run into the overlap, so the next segment only contributes from where the kept instructions
+end. A chunk of the next segment which started before that point cannot be copied partly, so its remaining
+bytes are written as literals read from the updated file.
+*/
+type deltaStitcher struct {
+	emitter     *deltaEmitter
+	signatures  *SignatureTable
+	reader      io.ReaderAt
+	size        int64
+	segmentSize int64
+	segment     int   // Index of the next segment
+	covered     int64 // Length of the part of the updated file the stitched delta already describes
+}
+
+func (s *deltaStitcher) add(delta Delta) error {
+	start := int64(s.segment) * s.segmentSize
+	end := min(start+s.segmentSize, s.size)
+	s.segment++
+
+	position := start
+	for _, op := range delta {
+		if position >= end {
+			break
+		}
+		switch op.Type {
+		case OpLiteral:
+			opEnd := position + int64(len(op.Data))
+			// Literals can be split anywhere, so they are cut at the end of the segment
+			from, to := max(s.covered, position), min(opEnd, end)
+			if from < to {
+				if err := s.emitter.literal(op.Data[from-position : to-position]...); err != nil {
+					return err
+				}
+				s.covered = to
+			}
+			position = opEnd
+		case OpCopy:
+			for index := op.BlockIndex; index < op.BlockIndex+op.Count && position < end; index++ {
+				blockEnd := position + int64(s.signatures.Blocks[index].Length)
+				if blockEnd > s.covered {
+					if err := s.copyChunk(index, position, blockEnd); err != nil {
+						return err
+					}
+					s.covered = blockEnd
+				}
+				position = blockEnd
+			}
+		}
+	}
+	// The segment was read up to its end unless the updated file is shorter than size
+	if position < end {
+		return NewReadUpdatedError(io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+// Copies the chunk at index found between start and end of the updated file, or only the part of it not covered yet.
+func (s *deltaStitcher) copyChunk(index int, start, end int64) error {
+	if start >= s.covered {
+		return s.emitter.copyChunk(index)
+	}
+	literals := make([]byte, end-s.covered)
+	if n, err := s.reader.ReadAt(literals, s.covered); n < len(literals) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return NewReadUpdatedError(err)
+	}
+	return s.emitter.literal(literals...)
+}
@@ -0,0 +1,277 @@
+package differ
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Psykepro/rdiff/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamSignaturesAt(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	data := make([]byte, 3*signatureBatchSize+123)
+	random.Read(data)
+
+	testCases := []struct {
+		name      string
+		size      int
+		chunkSize int
+	}{
+		{name: "Empty File", size: 0, chunkSize: 16},
+		{name: "Smaller Than A Chunk", size: 10, chunkSize: 16},
+		{name: "Single Range", size: 1000, chunkSize: 16},
+		{name: "Whole Ranges", size: 2 * signatureBatchSize, chunkSize: 1 << 16},
+		{name: "Short Last Range", size: len(data), chunkSize: 1 << 16},
+		{name: "Chunk Larger Than A Range", size: len(data), chunkSize: 3 * signatureBatchSize / 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			original := data[:tc.size]
+			expected, err := New(tc.chunkSize, WithWeakHash(hash.Rollsum)).GenerateSignatures(bytes.NewReader(original))
+			assert.NoError(t, err)
+
+			for _, jobs := range []int{1, 2, 8} {
+				differInstance := New(tc.chunkSize, WithWeakHash(hash.Rollsum), WithJobs(jobs))
+				signatures := differInstance.NewSignatureTable()
+				err := differInstance.StreamSignaturesAt(bytes.NewReader(original), int64(len(original)), signatures)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, signatures)
+			}
+		})
+	}
+}
+
+func TestStreamSignaturesAtErrors(t *testing.T) {
+	data := make([]byte, 3*signatureBatchSize)
+	differInstance := New(1024, WithJobs(4))
+
+	err := differInstance.StreamSignaturesAt(bytes.NewReader(data), int64(len(data)+1), differInstance.NewSignatureTable())
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	errSink := errors.New("sink failed")
+	var written int
+	err = differInstance.StreamSignaturesAt(bytes.NewReader(data), int64(len(data)), blockSinkFunc(func(block Block) error {
+		written++
+		if written == 2000 {
+			return errSink
+		}
+		return nil
+	}))
+	assert.ErrorIs(t, err, errSink)
+	assert.Equal(t, 2000, written)
+}
+
+func TestGenerateDeltaAt(t *testing.T) {
+	original, err := os.ReadFile(originalFilePath)
+	assert.NoError(t, err)
+	modified, err := os.ReadFile(modifiedFilePath)
+	assert.NoError(t, err)
+
+	random := rand.New(rand.NewSource(2))
+	randomOriginal := make([]byte, 20000)
+	random.Read(randomOriginal)
+	// Moves, repeats and inserts ranges of the original, so that chunks are found on both sides of segment borders
+	randomModified := append([]byte("inserted"), randomOriginal[5000:9000]...)
+	randomModified = append(randomModified, randomOriginal[:7000]...)
+	randomModified = append(randomModified, randomOriginal[3333:20000]...)
+
+	testCases := []struct {
+		name     string
+		original []byte
+		updated  []byte
+	}{
+		{name: "Test Data", original: original, updated: modified},
+		{name: "Test Data Reversed", original: modified, updated: original},
+		{name: "Moved Ranges", original: randomOriginal, updated: randomModified},
+		{name: "Empty Updated", original: randomOriginal, updated: nil},
+		{name: "Empty Original", original: []byte{}, updated: randomModified},
+		{name: "Smaller Than A Segment", original: randomOriginal, updated: randomOriginal[:20]},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, segmentSize := range []int64{32, 45, 100, 1000, deltaSegmentSize} {
+				for _, jobs := range []int{1, 3} {
+					differInstance := New(16, WithJobs(jobs))
+					differInstance.segmentSize = segmentSize
+					signatures, err := differInstance.GenerateSignatures(bytes.NewReader(tc.original))
+					assert.NoError(t, err)
+
+					var delta Delta
+					err = differInstance.GenerateDeltaAt(context.Background(), signatures, bytes.NewReader(tc.updated), int64(len(tc.updated)), &delta)
+					assert.NoError(t, err)
+
+					var patched bytes.Buffer
+					assert.NoError(t, differInstance.Apply(bytes.NewReader(tc.original), delta, &patched))
+					assert.Equal(t, tc.updated, patched.Bytes(), "segment size %d, %d jobs", segmentSize, jobs)
+
+					// A single segment is searched exactly like the sequential engine does
+					if segmentSize == deltaSegmentSize {
+						assert.Equal(t, generateDelta(t, differInstance, signatures, tc.updated), delta)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateDeltaAtCopiesAcrossSegments(t *testing.T) {
+	random := rand.New(rand.NewSource(3))
+	original := make([]byte, 64*1024)
+	random.Read(original)
+
+	differInstance := New(1024, WithJobs(4))
+	differInstance.segmentSize = 10000
+	signatures, err := differInstance.GenerateSignatures(bytes.NewReader(original))
+	assert.NoError(t, err)
+
+	var delta Delta
+	err = differInstance.GenerateDeltaAt(context.Background(), signatures, bytes.NewReader(original), int64(len(original)), &delta)
+	assert.NoError(t, err)
+	// Segment borders fall in the middle of chunks, which are still found thanks to the overlap
+	assert.Equal(t, Delta{Copy(0, 64)}, delta)
+}
+
+func TestGenerateDeltaAtCancelled(t *testing.T) {
+	differInstance := New(16, WithJobs(2))
+	differInstance.segmentSize = 64
+	signatures, err := differInstance.GenerateSignatures(bytes.NewReader(make([]byte, 1000)))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var delta Delta
+	err = differInstance.GenerateDeltaAt(ctx, signatures, bytes.NewReader(make([]byte, 1000)), 1000, &delta)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, delta)
+}
+
+func TestGenerateDeltaAtCanceledMidway(t *testing.T) {
+	differInstance := New(16, WithJobs(1), WithLiteralFlushSize(16))
+	differInstance.segmentSize = 64
+	signatures, err := differInstance.GenerateSignatures(bytes.NewReader(make([]byte, 1000)))
+	assert.NoError(t, err)
+	updated := bytes.Repeat([]byte("0123456789"), 100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var received int
+	sink := sinkFunc(func(op Op) error {
+		if received += len(op.Data); received >= 128 {
+			cancel()
+		}
+		return nil
+	})
+	err = differInstance.GenerateDeltaAt(ctx, signatures, bytes.NewReader(updated), int64(len(updated)), sink)
+	var canceled *CanceledError
+	if assert.ErrorAs(t, err, &canceled) {
+		// Processed counts what the stitched delta describes, from the start of the updated file
+		assert.GreaterOrEqual(t, canceled.Processed, int64(128))
+		assert.Less(t, canceled.Processed, int64(len(updated)))
+		assert.Zero(t, canceled.Processed%64)
+	}
+}
+
+var benchmarkJobs = []int{1, 2, 4, 8}
+
+func benchmarkFiles(b *testing.B) ([]byte, []byte) {
+	random := rand.New(rand.NewSource(4))
+	original := make([]byte, 16<<20)
+	random.Read(original)
+	updated := append([]byte(nil), original...)
+	// Changes one byte every 64 KiB, so that the delta mixes copies and literals
+	for i := 0; i < len(updated); i += 64 << 10 {
+		updated[i]++
+	}
+	b.ResetTimer()
+	return original, updated
+}
+
+func BenchmarkStreamSignatures(b *testing.B) {
+	original, _ := benchmarkFiles(b)
+	differInstance := New(1024)
+	b.SetBytes(int64(len(original)))
+	for i := 0; i < b.N; i++ {
+		differInstance.StreamSignatures(bytes.NewReader(original), blockSinkFunc(func(Block) error { return nil }))
+	}
+}
+
+func BenchmarkStreamSignaturesAt(b *testing.B) {
+	original, _ := benchmarkFiles(b)
+	for _, jobs := range benchmarkJobs {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			differInstance := New(1024, WithJobs(jobs))
+			b.SetBytes(int64(len(original)))
+			for i := 0; i < b.N; i++ {
+				differInstance.StreamSignaturesAt(bytes.NewReader(original), int64(len(original)), blockSinkFunc(func(Block) error { return nil }))
+			}
+		})
+	}
+}
+
+func BenchmarkGenerateDelta(b *testing.B) {
+	original, updated := benchmarkFiles(b)
+	differInstance := New(1024)
+	signatures, err := differInstance.GenerateSignatures(bytes.NewReader(original))
+	assert.NoError(b, err)
+	b.ResetTimer()
+	b.SetBytes(int64(len(updated)))
+	for i := 0; i < b.N; i++ {
+		differInstance.GenerateDelta(context.Background(), signatures, bytes.NewReader(updated), sinkFunc(func(Op) error { return nil }))
+	}
+}
+
+func BenchmarkGenerateDeltaAt(b *testing.B) {
+	original, updated := benchmarkFiles(b)
+	for _, jobs := range benchmarkJobs {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			differInstance := New(1024, WithJobs(jobs))
+			differInstance.segmentSize = 1 << 20
+			signatures, err := differInstance.GenerateSignatures(bytes.NewReader(original))
+			assert.NoError(b, err)
+			b.ResetTimer()
+			b.SetBytes(int64(len(updated)))
+			for i := 0; i < b.N; i++ {
+				differInstance.GenerateDeltaAt(context.Background(), signatures, bytes.NewReader(updated), int64(len(updated)), sinkFunc(func(Op) error { return nil }))
+			}
+		})
+	}
+}
+
+func TestRunOrdered(t *testing.T) {
+	var consumed []int
+	err := runOrdered(4, 100, func() func(task int) int {
+		return func(task int) int { return task }
+	}, func(result int) error {
+		consumed = append(consumed, result)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, consumed, 100)
+	for i, result := range consumed {
+		assert.Equal(t, i, result)
+	}
+
+	// Once consume fails, at most the tasks already queued behind the failed one are run
+	errConsume := errors.New("consume failed")
+	var started atomic.Int32
+	err = runOrdered(4, 1000, func() func(task int) int {
+		return func(task int) int {
+			started.Add(1)
+			return task
+		}
+	}, func(result int) error {
+		return errConsume
+	})
+	assert.ErrorIs(t, err, errConsume)
+	assert.LessOrEqual(t, started.Load(), int32(2*4+2))
+}
@@ -0,0 +1,79 @@
+package differ
+
+import "sync"
+
+/*
+Runs the tasks from 0 to count-1 on a pool of jobs workers and hands their results to consume in task
+order. Every worker gets its own function from newWorker, so that it can reuse its buffers between
+tasks. At most jobs results wait to be consumed, which bounds the memory in use, and the first error
+returned by consume stops the pool.
+*/
+func runOrdered[T any](jobs, count int, newWorker func() func(task int) T, consume func(result T) error) error {
+	type task struct {
+		index  int
+		result chan<- T
+	}
+	tasks := make(chan task)
+	// Results are queued in task order, so consume sees them in order whichever worker finishes first
+	results := make(chan chan T, jobs)
+	done := make(chan struct{})
+
+	var workers sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			work := newWorker()
+			for t := range tasks {
+				// A task received while the pool stops is dropped, nobody consumes its result anymore
+				if stopped(done) {
+					return
+				}
+				t.result <- work(t.index)
+			}
+		}()
+	}
+	defer func() {
+		close(done)
+		workers.Wait()
+	}()
+
+	go func() {
+		defer close(tasks)
+		defer close(results)
+		for index := 0; index < count; index++ {
+			// select picks a ready case at random, so done is checked first to not dispatch more tasks once it is closed
+			if stopped(done) {
+				return
+			}
+			result := make(chan T, 1)
+			select {
+			case results <- result:
+			case <-done:
+				return
+			}
+			select {
+			case tasks <- task{index: index, result: result}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for result := range results {
+		if err := consume(<-result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reports whether done is closed, without blocking.
+func stopped(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
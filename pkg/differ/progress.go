@@ -0,0 +1,130 @@
+package differ
+
+import "time"
+
+// Number of bytes read between two reports of the progress, besides the final one.
+const progressInterval = 1 << 20
+
+// Operation whose progress is reported.
+type Stage string
+
+const (
+	StageSignatures Stage = "signatures"
+	StageDelta      Stage = "delta"
+)
+
+// Progress of generating signatures or a delta, handed to the function set with WithProgress.
+type Progress struct {
+	Stage   Stage
+	Read    int64 // Bytes of the input read so far
+	Matched int64 // Bytes of the updated file copied from the original file, zero for signatures
+	Literal int64 // Bytes of the updated file written as literals, zero for signatures
+	Elapsed time.Duration
+	Done    bool // Set on the last report of the operation, which is made even when it fails
+}
+
+// Bytes read per second since the operation started.
+func (p Progress) Throughput() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Read) / p.Elapsed.Seconds()
+}
+
+/*
+Reports the progress of generating signatures and deltas to fn, every MiB read and once more when the
+operation ends. fn is called from the goroutine running the operation, never concurrently, and slows it down
+if it blocks.
+*/
+func WithProgress(fn func(Progress)) Option {
+	return func(d *Differ) {
+		d.progress = fn
+	}
+}
+
+// Collects the progress of one operation. A nil tracker ignores everything, so that progress costs nothing when not reported.
+type progressTracker struct {
+	report     func(Progress)
+	signatures *SignatureTable // Chunks of the original file, which give the length of the copied ones
+	start      time.Time
+	progress   Progress
+	reported   int64 // Bytes read at the last report
+}
+
+func (d *Differ) newProgressTracker(stage Stage, signatures *SignatureTable) *progressTracker {
+	if d.progress == nil {
+		return nil
+	}
+	return &progressTracker{
+		report:     d.progress,
+		signatures: signatures,
+		start:      time.Now(),
+		progress:   Progress{Stage: stage},
+	}
+}
+
+// Records that the first read bytes of the input were handled, and reports them every progressInterval bytes.
+func (t *progressTracker) read(read int64) {
+	if t == nil {
+		return
+	}
+	t.progress.Read = read
+	if read-t.reported >= progressInterval {
+		t.emit()
+	}
+}
+
+// Makes the last report of the operation and passes its error through.
+func (t *progressTracker) finish(err error) error {
+	if t != nil {
+		t.progress.Done = true
+		t.emit()
+	}
+	return err
+}
+
+func (t *progressTracker) emit() {
+	t.progress.Elapsed = time.Since(t.start)
+	t.reported = t.progress.Read
+	t.report(t.progress)
+}
+
+// Wraps sink, so that the chunks written to it count as read.
+func (t *progressTracker) signatureSink(sink SignatureSink) SignatureSink {
+	if t == nil {
+		return sink
+	}
+	return progressSignatureSink{sink: sink, tracker: t}
+}
+
+// Counts the chunk of the original file at index as matched. The last chunk can be shorter than the others.
+func (t *progressTracker) copiedChunk(index int) {
+	if t != nil {
+		t.progress.Matched += int64(t.signatures.Blocks[index].Length)
+	}
+}
+
+func (t *progressTracker) copied(length int) {
+	if t != nil {
+		t.progress.Matched += int64(length)
+	}
+}
+
+func (t *progressTracker) literal(length int) {
+	if t != nil {
+		t.progress.Literal += int64(length)
+	}
+}
+
+type progressSignatureSink struct {
+	sink    SignatureSink
+	tracker *progressTracker
+}
+
+func (s progressSignatureSink) WriteBlock(block Block) error {
+	if err := s.sink.WriteBlock(block); err != nil {
+		return err
+	}
+	s.tracker.read(block.Offset + int64(block.Length))
+	return nil
+}
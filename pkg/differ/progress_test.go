@@ -0,0 +1,93 @@
+package differ
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgress(t *testing.T) {
+	random := rand.New(rand.NewSource(5))
+	original := make([]byte, 3*progressInterval+100)
+	random.Read(original)
+	// Half of the updated file is copied from the original file, the other half is new
+	updated := make([]byte, len(original))
+	copy(updated, original[:len(original)/2])
+	random.Read(updated[len(original)/2:])
+
+	testCases := []struct {
+		name     string
+		options  []Option
+		parallel bool
+	}{
+		{name: "Sequential"},
+		{name: "Parallel", options: []Option{WithJobs(3)}, parallel: true},
+		{name: "Content-Defined Chunks", options: []Option{WithContentDefinedChunking(256, 8192)}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var reports []Progress
+			differInstance := New(1024, append(tc.options, WithProgress(func(progress Progress) {
+				reports = append(reports, progress)
+			}))...)
+			differInstance.segmentSize = progressInterval / 2
+
+			signatures := differInstance.NewSignatureTable()
+			if tc.parallel {
+				assert.NoError(t, differInstance.StreamSignaturesAt(bytes.NewReader(original), int64(len(original)), signatures))
+			} else {
+				assert.NoError(t, differInstance.StreamSignatures(bytes.NewReader(original), signatures))
+			}
+			assertProgress(t, reports, StageSignatures, int64(len(original)))
+			last := reports[len(reports)-1]
+			assert.Zero(t, last.Matched)
+			assert.Zero(t, last.Literal)
+
+			reports = nil
+			var delta Delta
+			if tc.parallel {
+				err := differInstance.GenerateDeltaAt(context.Background(), signatures, bytes.NewReader(updated), int64(len(updated)), &delta)
+				assert.NoError(t, err)
+			} else {
+				assert.NoError(t, differInstance.GenerateDelta(context.Background(), signatures, bytes.NewReader(updated), &delta))
+			}
+			assertProgress(t, reports, StageDelta, int64(len(updated)))
+			last = reports[len(reports)-1]
+			assert.Equal(t, last.Read, last.Matched+last.Literal)
+			// Chunks crossing the middle of the updated file are written as literals
+			assert.InDelta(t, len(updated)/2, last.Matched, 8192)
+		})
+	}
+}
+
+// Checks that the progress was reported every progressInterval bytes and once more at the end.
+func assertProgress(t *testing.T, reports []Progress, stage Stage, size int64) {
+	if !assert.NotEmpty(t, reports) {
+		return
+	}
+	assert.GreaterOrEqual(t, len(reports), int(size/progressInterval))
+	for i, report := range reports {
+		assert.Equal(t, stage, report.Stage)
+		assert.Equal(t, i == len(reports)-1, report.Done)
+		if i > 0 {
+			assert.GreaterOrEqual(t, report.Read, reports[i-1].Read)
+		}
+	}
+	last := reports[len(reports)-1]
+	assert.Equal(t, size, last.Read)
+	assert.Positive(t, last.Throughput())
+}
+
+func TestProgressWithoutCallback(t *testing.T) {
+	var tracker *progressTracker
+	tracker.read(10)
+	tracker.copiedChunk(3)
+	tracker.literal(10)
+	assert.NoError(t, tracker.finish(nil))
+	sink := &SignatureTable{}
+	assert.Equal(t, sink, tracker.signatureSink(sink))
+}
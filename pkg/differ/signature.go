@@ -0,0 +1,97 @@
+package differ
+
+import "github.com/Psykepro/rdiff/pkg/hash"
+
+// Describes a single chunk of the original file.
+type Block struct {
+	Index      int
+	Offset     int64
+	Length     int
+	WeakHash   uint32
+	StrongHash []byte
+}
+
+/*
+Receives the chunks of the original file in order, as soon as their hashes are calculated.
+The strong hash of a block is only valid until WriteBlock returns, so sinks keeping it have to copy it.
+*/
+type SignatureSink interface {
+	WriteBlock(block Block) error
+}
+
+/*
+Holds every chunk of the original file in order. Chunks are also indexed by their weak hash,
+so that identical chunks and chunks whose weak hashes collide are all kept as candidates.
+*/
+type SignatureTable struct {
+	ChunkSize    int
+	WeakHash     hash.WeakHash
+	StrongHash   hash.StrongHash
+	StrongLength int    //Length in bytes the strong hashes of the chunks are truncated to
+	MinChunkSize int    //Smallest content-defined chunk, zero for chunks of a fixed size
+	MaxChunkSize int    //Largest content-defined chunk, zero for chunks of a fixed size
+	Digest       []byte //SHA-256 digest of the whole original file, nil when it is not known
+	Blocks       []Block
+	weakIndex    map[uint32][]int
+}
+
+func NewSignatureTable(chunkSize int, weakHash hash.WeakHash, strongHash hash.StrongHash, strongLength int, blocks []Block) *SignatureTable {
+	table := &SignatureTable{
+		ChunkSize:    chunkSize,
+		WeakHash:     weakHash,
+		StrongHash:   strongHash,
+		StrongLength: strongLength,
+		weakIndex:    make(map[uint32][]int),
+	}
+	for _, block := range blocks {
+		table.Add(block)
+	}
+	return table
+}
+
+func (s *SignatureTable) Add(block Block) {
+	s.Blocks = append(s.Blocks, block)
+	s.weakIndex[block.WeakHash] = append(s.weakIndex[block.WeakHash], len(s.Blocks)-1)
+}
+
+// Adds a copy of the block, so that a SignatureTable can be used as a SignatureSink.
+func (s *SignatureTable) WriteBlock(block Block) error {
+	block.StrongHash = append([]byte(nil), block.StrongHash...)
+	s.Add(block)
+	return nil
+}
+
+// Records the digest of the original file, so that a SignatureTable generated by a Differ always holds it.
+func (s *SignatureTable) WriteDigest(length int64, digest []byte) error {
+	s.Digest = digest
+	return nil
+}
+
+/*
+Returns the positions in Blocks of all chunks with the given weak hash, in the order they appear in the original file.
+The slice is the one of the index, so it is not copied and must not be modified.
+*/
+func (s *SignatureTable) Lookup(weakHash uint32) []int {
+	return s.weakIndex[weakHash]
+}
+
+/*
+Tells whether the chunks end at content-defined boundaries instead of every ChunkSize bytes.
+ChunkSize is then the average length of the chunks, which vary between MinChunkSize and MaxChunkSize.
+*/
+func (s *SignatureTable) ContentDefined() bool {
+	return s.MaxChunkSize > 0
+}
+
+func (s *SignatureTable) Len() int {
+	return len(s.Blocks)
+}
+
+// Length of the original file, which is where its last chunk ends.
+func (s *SignatureTable) FileSize() int64 {
+	if len(s.Blocks) == 0 {
+		return 0
+	}
+	last := s.Blocks[len(s.Blocks)-1]
+	return last.Offset + int64(last.Length)
+}
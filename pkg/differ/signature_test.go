@@ -0,0 +1,276 @@
+package differ
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/Psykepro/rdiff/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignatureTableLookup(t *testing.T) {
+	signatures := NewSignatureTable(16, hash.Adler32, hash.SHA256, 1, []Block{
+		{Index: 0, Offset: 0, Length: 16, WeakHash: 7, StrongHash: []byte{1}},
+		{Index: 1, Offset: 16, Length: 16, WeakHash: 9, StrongHash: []byte{2}},
+		{Index: 2, Offset: 32, Length: 16, WeakHash: 7, StrongHash: []byte{3}},
+	})
+
+	assert.Equal(t, 3, signatures.Len())
+	assert.Equal(t, []int{0, 2}, signatures.Lookup(7))
+	assert.Equal(t, []int{1}, signatures.Lookup(9))
+	assert.Nil(t, signatures.Lookup(8))
+}
+
+func TestGenerateSignaturesIdenticalChunks(t *testing.T) {
+	zeros := make([]byte, 16)
+	original := append(bytes.Repeat(zeros, 4), []byte("unique chunk....")...)
+	original = append(original, bytes.Repeat(zeros, 3)...)
+
+	differInstance := New(16)
+	signatures, err := differInstance.GenerateSignatures(bufio.NewReader(bytes.NewReader(original)))
+	assert.NoError(t, err)
+
+	assert.Equal(t, 8, signatures.Len())
+	candidates := signatures.Lookup(signatures.Blocks[0].WeakHash)
+	assert.Equal(t, []int{0, 1, 2, 3, 5, 6, 7}, candidates)
+	for _, position := range candidates {
+		assert.Equal(t, int64(position*16), signatures.Blocks[position].Offset)
+	}
+}
+
+func TestStreamSignatures(t *testing.T) {
+	original := []byte("This is a Rolling hash file diff algorithm. It should check for changes in file and text")
+	differInstance := New(16)
+
+	// The sink only sees each block while WriteBlock runs, the strong hash buffer is reused afterwards
+	var blocks []Block
+	var strongHashes [][]byte
+	sink := blockSinkFunc(func(block Block) error {
+		blocks = append(blocks, block)
+		strongHashes = append(strongHashes, append([]byte(nil), block.StrongHash...))
+		return nil
+	})
+	assert.NoError(t, differInstance.StreamSignatures(bytes.NewReader(original), sink))
+
+	signatures, err := differInstance.GenerateSignatures(bytes.NewReader(original))
+	assert.NoError(t, err)
+	assert.Len(t, blocks, signatures.Len())
+	for i, block := range signatures.Blocks {
+		assert.Equal(t, block.Index, blocks[i].Index)
+		assert.Equal(t, block.Offset, blocks[i].Offset)
+		assert.Equal(t, block.Length, blocks[i].Length)
+		assert.Equal(t, block.WeakHash, blocks[i].WeakHash)
+		assert.Equal(t, block.StrongHash, strongHashes[i])
+	}
+	assert.Equal(t, 8, signatures.Blocks[len(signatures.Blocks)-1].Length)
+}
+
+func TestStreamSignaturesErrors(t *testing.T) {
+	errSink := errors.New("sink failed")
+	differInstance := New(16)
+
+	err := differInstance.StreamSignatures(bytes.NewReader(make([]byte, 64)), blockSinkFunc(func(block Block) error {
+		return errSink
+	}))
+	assert.ErrorIs(t, err, errSink)
+
+	err = differInstance.StreamSignatures(iotest.ErrReader(errSink), NewSignatureTable(16, hash.Adler32, hash.BLAKE2b, 32, nil))
+	assert.ErrorIs(t, err, errSink)
+}
+
+func TestGenerateSignaturesShortReads(t *testing.T) {
+	original, err := os.ReadFile(originalFilePath)
+	assert.NoError(t, err)
+	modified, err := os.ReadFile(modifiedFilePath)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		reader func(r io.Reader) io.Reader
+	}{
+		{name: "One Byte Reader", reader: iotest.OneByteReader},
+		{name: "Half Reader", reader: iotest.HalfReader},
+		{name: "Data Error Reader", reader: iotest.DataErrReader},
+		{name: "Buffered One Byte Reader", reader: func(r io.Reader) io.Reader {
+			return bufio.NewReaderSize(iotest.OneByteReader(r), 16)
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			differInstance := New(16)
+			expected, err := differInstance.GenerateSignatures(bytes.NewReader(original))
+			assert.NoError(t, err)
+			signatures, err := differInstance.GenerateSignatures(tc.reader(bytes.NewReader(original)))
+			assert.NoError(t, err)
+			assert.Equal(t, expected, signatures)
+			assert.Equal(t, int64(len(original)), signatures.FileSize())
+			for _, block := range signatures.Blocks[:signatures.Len()-1] {
+				assert.Equal(t, 16, block.Length)
+			}
+
+			var delta Delta
+			err = differInstance.GenerateDelta(context.Background(), signatures, tc.reader(bytes.NewReader(modified)), &delta)
+			assert.NoError(t, err)
+			var patched bytes.Buffer
+			assert.NoError(t, differInstance.Apply(bytes.NewReader(original), delta, &patched))
+			assert.Equal(t, modified, patched.Bytes())
+		})
+	}
+}
+
+func TestStreamSignaturesLastChunk(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          string
+		expectedLength []int
+	}{
+		{name: "Exact Chunks", input: "abcdabcd", expectedLength: []int{4, 4}},
+		{name: "Short Last Chunk", input: "abcdabcdab", expectedLength: []int{4, 4, 2}},
+		{name: "Single Short Chunk", input: "ab", expectedLength: []int{2}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			differInstance := New(4)
+			signatures, err := differInstance.GenerateSignatures(iotest.HalfReader(strings.NewReader(tc.input)))
+			assert.NoError(t, err)
+			var lengths []int
+			for _, block := range signatures.Blocks {
+				lengths = append(lengths, block.Length)
+			}
+			assert.Equal(t, tc.expectedLength, lengths)
+		})
+	}
+}
+
+type blockSinkFunc func(block Block) error
+
+func (f blockSinkFunc) WriteBlock(block Block) error {
+	return f(block)
+}
+
+func TestGenerateDeltaIdenticalChunks(t *testing.T) {
+	zeros := make([]byte, 16)
+	unique := []byte("unique chunk....")
+
+	original := append(bytes.Repeat(zeros, 4), unique...)
+	original = append(original, bytes.Repeat(zeros, 3)...)
+
+	testCases := []struct {
+		name          string
+		updated       []byte
+		expectedDelta Delta
+	}{
+		{
+			name:          "No Changes",
+			updated:       original,
+			expectedDelta: Delta{Copy(0, 8)},
+		},
+		{
+			name:          "Fewer Identical Chunks",
+			updated:       append(append(bytes.Repeat(zeros, 2), unique...), zeros...),
+			expectedDelta: Delta{Copy(0, 2), Copy(4, 2)},
+		},
+		{
+			name:          "More Identical Chunks",
+			updated:       append(append(bytes.Repeat(zeros, 6), unique...), bytes.Repeat(zeros, 5)...),
+			expectedDelta: Delta{Copy(0, 4), Copy(0, 2), Copy(4, 4), Copy(0, 2)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			differInstance := New(16)
+			signatures, err := differInstance.GenerateSignatures(bufio.NewReader(bytes.NewReader(original)))
+			assert.NoError(t, err)
+			delta := generateDelta(t, differInstance, signatures, tc.updated)
+			assert.Equal(t, tc.expectedDelta, delta)
+			assert.Equal(t, tc.updated, roundTrip(t, differInstance, original, tc.updated))
+		})
+	}
+}
+
+func TestGenerateDeltaZeroFilledFile(t *testing.T) {
+	// Every chunk but the shorter last one is a candidate for every window, like the free space of a disk image
+	original := make([]byte, 8<<20+100)
+	updated := append([]byte("new header"), original...)
+	differInstance := New(512)
+	signatures, err := differInstance.GenerateSignatures(bytes.NewReader(original))
+	assert.NoError(t, err)
+	chunks := signatures.Len()
+
+	assert.Equal(t, Delta{Copy(0, chunks)}, generateDelta(t, differInstance, signatures, original))
+	assert.Equal(t, Delta{Literal([]byte("new header")), Copy(0, chunks)}, generateDelta(t, differInstance, signatures, updated))
+}
+
+func BenchmarkGenerateDeltaZeroFilledFile(b *testing.B) {
+	original := make([]byte, 8<<20+100)
+	differInstance := New(512)
+	signatures, err := differInstance.GenerateSignatures(bytes.NewReader(original))
+	assert.NoError(b, err)
+
+	b.SetBytes(int64(len(original)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var delta Delta
+		assert.NoError(b, differInstance.GenerateDelta(context.Background(), signatures, bytes.NewReader(original), &delta))
+	}
+}
+
+func TestGenerateDeltaWeakHashCollision(t *testing.T) {
+	// Both chunks have the same Adler-32 hash since the changes of the sums cancel each other out
+	original := []byte("Colliding chunk aca")
+	updated := []byte("Colliding chunk bab")
+
+	testCases := []struct {
+		name          string
+		strongHash    hash.StrongHash
+		strongLength  int
+		expectedDelta Delta
+	}{
+		{
+			name:          "BLAKE2b",
+			strongHash:    hash.BLAKE2b,
+			expectedDelta: Delta{Copy(0, 1), Literal([]byte("bab"))},
+		},
+		{
+			name:          "Truncated SHA256",
+			strongHash:    hash.SHA256,
+			strongLength:  8,
+			expectedDelta: Delta{Copy(0, 1), Literal([]byte("bab"))},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			differInstance := New(16, WithStrongHash(tc.strongHash, tc.strongLength))
+			signatures, err := differInstance.GenerateSignatures(bufio.NewReader(bytes.NewReader(original)))
+			assert.NoError(t, err)
+			assert.Equal(t, signatures.Blocks[1].WeakHash, weakHash([]byte("bab")))
+
+			delta := generateDelta(t, differInstance, signatures, updated)
+			assert.Equal(t, tc.expectedDelta, delta)
+			assert.Equal(t, updated, roundTrip(t, differInstance, original, updated))
+		})
+	}
+}
+
+func TestNewStrongLength(t *testing.T) {
+	assert.Equal(t, 32, New(16).strongLength)
+	assert.Equal(t, 8, New(16, WithStrongHash(hash.SHA256, 8)).strongLength)
+	assert.Equal(t, 32, New(16, WithStrongHash(hash.SHA256, 64)).strongLength)
+}
+
+func weakHash(data []byte) uint32 {
+	adler32 := hash.NewAdler32(len(data))
+	adler32.Write(data)
+	return adler32.Sum32()
+}
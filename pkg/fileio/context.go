@@ -0,0 +1,67 @@
+package fileio
+
+import (
+	"context"
+	"io"
+
+	"github.com/Psykepro/rdiff/pkg/differ"
+)
+
+/*
+Reader failing with a *differ.CanceledError once ctx is done. The context is checked before every read,
+and the files are read through buffers, so it is checked once per block of the file.
+*/
+type ContextReader struct {
+	ctx       context.Context
+	reader    io.Reader
+	processed int64
+}
+
+func NewContextReader(ctx context.Context, r io.Reader) *ContextReader {
+	return &ContextReader{ctx: ctx, reader: r}
+}
+
+func (r *ContextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, &differ.CanceledError{Processed: r.processed, Err: err}
+	}
+	n, err := r.reader.Read(p)
+	r.processed += int64(n)
+	return n, err
+}
+
+// Returns a *differ.CanceledError instead of err once ctx is done, so that a cancelled read is not reported as a truncated file.
+func (r *ContextReader) Cause(err error) error {
+	if ctxErr := r.ctx.Err(); err != nil && ctxErr != nil {
+		return &differ.CanceledError{Processed: r.processed, Err: ctxErr}
+	}
+	return err
+}
+
+// Writer failing with a *differ.CanceledError once ctx is done. The context is checked before every write.
+type ContextWriter struct {
+	ctx       context.Context
+	writer    io.Writer
+	processed int64
+}
+
+func NewContextWriter(ctx context.Context, w io.Writer) *ContextWriter {
+	return &ContextWriter{ctx: ctx, writer: w}
+}
+
+func (w *ContextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, &differ.CanceledError{Processed: w.processed, Err: err}
+	}
+	n, err := w.writer.Write(p)
+	w.processed += int64(n)
+	return n, err
+}
+
+// Returns a *differ.CanceledError instead of err once ctx is done, so that a cancelled write is not reported as an encoding error.
+func (w *ContextWriter) Cause(err error) error {
+	if ctxErr := w.ctx.Err(); err != nil && ctxErr != nil {
+		return &differ.CanceledError{Processed: w.processed, Err: ctxErr}
+	}
+	return err
+}
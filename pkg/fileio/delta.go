@@ -0,0 +1,359 @@
+package fileio
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	gohash "hash"
+	"io"
+	"math"
+
+	"github.com/Psykepro/rdiff/pkg/differ"
+)
+
+/*
+Delta file format:
+
+	magic "RDDL"
+	format version, 1 byte
+	chunk size of the signatures the delta was generated from, uvarint
+	length of the original file uvarint, length of its digest 1 byte, SHA-256 digest of the original file
+	sequence of instructions, each starting with its 1 byte opcode:
+		0x01 COPY     index of the first chunk uvarint, number of chunks uvarint
+		0x02 LITERAL  number of literals uvarint, literals
+		0x03 COPY_RANGE  offset in the original file uvarint, number of bytes uvarint
+		0x00 END      length of the updated file uvarint, SHA-256 digest of the updated file
+
+The instructions are written as soon as they are found and END is always the last one,
+since the length and digest of the updated file are only known after reading all of it.
+COPY_RANGE is only used by deltas generated from content-defined chunks, whose offsets do not follow from the chunk size.
+The digest of the original file is empty when the signatures did not record it, and only its length is then verified.
+*/
+const (
+	DeltaMagic   = "RDDL"
+	DeltaVersion = 1
+
+	// Longer literals are split in several instructions, so that a delta can be read with bounded memory
+	MaxLiteralLength = 1 << 20
+)
+
+const (
+	opEnd       byte = 0x00
+	opCopy      byte = 0x01
+	opLiteral   byte = 0x02
+	opCopyRange byte = 0x03
+)
+
+/*
+Length and SHA-256 digest of a whole file, the original file a delta applies to or the updated file it rebuilds.
+Everything written to it is accounted for.
+*/
+type FileChecksum struct {
+	length int64
+	digest gohash.Hash
+}
+
+func NewFileChecksum() *FileChecksum {
+	return &FileChecksum{digest: sha256.New()}
+}
+
+func (c *FileChecksum) Write(p []byte) (int, error) {
+	c.length += int64(len(p))
+	return c.digest.Write(p)
+}
+
+func (c *FileChecksum) Length() int64 {
+	return c.length
+}
+
+// SHA-256 digest of everything written so far.
+func (c *FileChecksum) Digest() []byte {
+	return c.digest.Sum(nil)
+}
+
+// Encodes a delta instruction by instruction.
+type DeltaWriter struct {
+	writer       *bufio.Writer
+	buffer       []byte
+	targetLength int64
+	targetDigest []byte
+}
+
+/*
+Creates a writer for a delta against the original file of signatures and writes the header of the delta,
+which holds the length and digest of the original file so that patching can refuse any other file.
+*/
+func NewDeltaWriter(w io.Writer, signatures *differ.SignatureTable) (*DeltaWriter, error) {
+	if len(signatures.Digest) > math.MaxUint8 {
+		return nil, NewEncodeDeltaError(fmt.Errorf("digest of the original file is %d bytes long", len(signatures.Digest)))
+	}
+	d := &DeltaWriter{writer: bufio.NewWriter(w)}
+	d.buffer = append(d.buffer, DeltaMagic...)
+	d.buffer = append(d.buffer, DeltaVersion)
+	d.buffer = binary.AppendUvarint(d.buffer, uint64(signatures.ChunkSize))
+	d.buffer = binary.AppendUvarint(d.buffer, uint64(signatures.FileSize()))
+	d.buffer = append(d.buffer, byte(len(signatures.Digest)))
+	d.buffer = append(d.buffer, signatures.Digest...)
+	if err := d.flushBuffer(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *DeltaWriter) WriteOp(op differ.Op) error {
+	switch op.Type {
+	case differ.OpCopy:
+		d.buffer = append(d.buffer, opCopy)
+		d.buffer = binary.AppendUvarint(d.buffer, uint64(op.BlockIndex))
+		d.buffer = binary.AppendUvarint(d.buffer, uint64(op.Count))
+		return d.flushBuffer()
+	case differ.OpCopyRange:
+		d.buffer = append(d.buffer, opCopyRange)
+		d.buffer = binary.AppendUvarint(d.buffer, uint64(op.Offset))
+		d.buffer = binary.AppendUvarint(d.buffer, uint64(op.Length))
+		return d.flushBuffer()
+	case differ.OpLiteral:
+		for data := op.Data; len(data) > 0; {
+			literals := data[:min(len(data), MaxLiteralLength)]
+			data = data[len(literals):]
+
+			d.buffer = append(d.buffer, opLiteral)
+			d.buffer = binary.AppendUvarint(d.buffer, uint64(len(literals)))
+			if err := d.flushBuffer(); err != nil {
+				return err
+			}
+			if _, err := d.writer.Write(literals); err != nil {
+				return NewEncodeDeltaError(err)
+			}
+		}
+		return nil
+	default:
+		return NewEncodeDeltaError(fmt.Errorf("unknown instruction %v", op.Type))
+	}
+}
+
+// Keeps the length and digest of the updated file, which Close writes in the END instruction.
+func (d *DeltaWriter) WriteDigest(length int64, digest []byte) error {
+	if len(digest) != sha256.Size {
+		return NewEncodeDeltaError(fmt.Errorf("digest of the updated file is %d bytes long instead of %d", len(digest), sha256.Size))
+	}
+	d.targetLength = length
+	d.targetDigest = digest
+	return nil
+}
+
+/*
+Writes the END instruction with the length and digest of the updated file and flushes the delta. The digest
+is written by the differ generating the delta, or with WriteDigest, and a delta without it is refused.
+*/
+func (d *DeltaWriter) Close() error {
+	if d.targetDigest == nil {
+		return NewEncodeDeltaError(fmt.Errorf("digest of the updated file was not written"))
+	}
+	d.buffer = append(d.buffer, opEnd)
+	d.buffer = binary.AppendUvarint(d.buffer, uint64(d.targetLength))
+	d.buffer = append(d.buffer, d.targetDigest...)
+	if err := d.flushBuffer(); err != nil {
+		return err
+	}
+	if err := d.writer.Flush(); err != nil {
+		return NewEncodeDeltaError(err)
+	}
+	return nil
+}
+
+func (d *DeltaWriter) flushBuffer() error {
+	_, err := d.writer.Write(d.buffer)
+	d.buffer = d.buffer[:0]
+	if err != nil {
+		return NewEncodeDeltaError(err)
+	}
+	return nil
+}
+
+// Decodes a delta instruction by instruction.
+type DeltaReader struct {
+	reader       *bufio.Reader
+	chunkSize    int
+	basisLength  int64
+	basisDigest  []byte
+	targetLength int64
+	targetDigest []byte
+	done         bool
+}
+
+// Creates a delta reader and reads the header of the delta.
+func NewDeltaReader(r io.Reader) (*DeltaReader, error) {
+	d := &DeltaReader{reader: bufio.NewReader(r)}
+
+	header := make([]byte, len(DeltaMagic)+1)
+	if _, err := io.ReadFull(d.reader, header); err != nil {
+		return nil, NewDecodeDeltaError(err)
+	}
+	if string(header[:len(DeltaMagic)]) != DeltaMagic {
+		return nil, NewDecodeDeltaError(fmt.Errorf("not a delta file"))
+	}
+	if version := header[len(DeltaMagic)]; version != DeltaVersion {
+		return nil, NewDecodeDeltaError(fmt.Errorf("unsupported version %d", version))
+	}
+	chunkSize, err := d.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if chunkSize < 1 || chunkSize > MaxChunkSize {
+		return nil, NewDecodeDeltaError(fmt.Errorf("invalid chunk size %d", chunkSize))
+	}
+	d.chunkSize = chunkSize
+
+	basisLength, err := d.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	digestLength, err := d.reader.ReadByte()
+	if err != nil {
+		return nil, NewDecodeDeltaError(NoEOF(err))
+	}
+	if digestLength != 0 && digestLength != sha256.Size {
+		return nil, NewDecodeDeltaError(fmt.Errorf("invalid digest length %d", digestLength))
+	}
+	d.basisLength = int64(basisLength)
+	if digestLength > 0 {
+		d.basisDigest = make([]byte, digestLength)
+		if _, err := io.ReadFull(d.reader, d.basisDigest); err != nil {
+			return nil, NewDecodeDeltaError(NoEOF(err))
+		}
+	}
+	return d, nil
+}
+
+func (d *DeltaReader) ChunkSize() int {
+	return d.chunkSize
+}
+
+// Length of the original file the delta was generated against.
+func (d *DeltaReader) BasisLength() int64 {
+	return d.basisLength
+}
+
+// SHA-256 digest of the original file the delta was generated against, nil when the delta does not record it.
+func (d *DeltaReader) BasisDigest() []byte {
+	return d.basisDigest
+}
+
+/*
+Checks that the original file the delta is about to be applied to is the one it was generated against,
+by its length and digest. The digest is only checked when the delta records it.
+*/
+func (d *DeltaReader) VerifyBasis(basis *FileChecksum) error {
+	if basis.Length() != d.basisLength {
+		return NewBasisMismatchError(fmt.Errorf("original file is %d bytes long instead of %d", basis.Length(), d.basisLength))
+	}
+	if d.basisDigest != nil && !bytes.Equal(basis.Digest(), d.basisDigest) {
+		return NewBasisMismatchError(fmt.Errorf("digest of the original file differs"))
+	}
+	return nil
+}
+
+// Returns the next instruction of the delta, or io.EOF once the END instruction has been read.
+func (d *DeltaReader) Next() (differ.Op, error) {
+	if d.done {
+		return differ.Op{}, io.EOF
+	}
+
+	opcode, err := d.reader.ReadByte()
+	if err != nil {
+		return differ.Op{}, NewDecodeDeltaError(NoEOF(err))
+	}
+	switch opcode {
+	case opCopy:
+		index, err := d.readUvarint()
+		if err != nil {
+			return differ.Op{}, err
+		}
+		count, err := d.readUvarint()
+		if err != nil {
+			return differ.Op{}, err
+		}
+		return differ.Copy(index, count), nil
+	case opCopyRange:
+		offset, err := d.readUvarint()
+		if err != nil {
+			return differ.Op{}, err
+		}
+		length, err := d.readUvarint()
+		if err != nil {
+			return differ.Op{}, err
+		}
+		return differ.CopyRange(int64(offset), length), nil
+	case opLiteral:
+		length, err := d.readUvarint()
+		if err != nil {
+			return differ.Op{}, err
+		}
+		if length > MaxLiteralLength {
+			return differ.Op{}, NewDecodeDeltaError(fmt.Errorf("literal of %d bytes is too long", length))
+		}
+		literals := make([]byte, length)
+		if _, err := io.ReadFull(d.reader, literals); err != nil {
+			return differ.Op{}, NewDecodeDeltaError(NoEOF(err))
+		}
+		return differ.Literal(literals), nil
+	case opEnd:
+		targetLength, err := binary.ReadUvarint(d.reader)
+		if err != nil {
+			return differ.Op{}, NewDecodeDeltaError(NoEOF(err))
+		}
+		d.targetLength = int64(targetLength)
+		d.targetDigest = make([]byte, sha256.Size)
+		if _, err := io.ReadFull(d.reader, d.targetDigest); err != nil {
+			return differ.Op{}, NewDecodeDeltaError(NoEOF(err))
+		}
+		// Anything after END would be ignored, so a delta followed by other data is refused
+		if _, err := d.reader.ReadByte(); err != io.EOF {
+			if err == nil {
+				err = fmt.Errorf("unexpected data after the END instruction")
+			}
+			return differ.Op{}, NewDecodeDeltaError(err)
+		}
+		d.done = true
+		return differ.Op{}, io.EOF
+	default:
+		return differ.Op{}, NewDecodeDeltaError(fmt.Errorf("unknown opcode 0x%02x", opcode))
+	}
+}
+
+// Checks the updated file produced by applying the delta against the length and digest stored in it.
+func (d *DeltaReader) Verify(target *FileChecksum) error {
+	if !d.done {
+		return NewDecodeDeltaError(fmt.Errorf("delta has not been read to its end"))
+	}
+	if target.Length() != d.targetLength || !bytes.Equal(target.Digest(), d.targetDigest) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// Reads a uvarint which has to fit in an int.
+func (d *DeltaReader) readUvarint() (int, error) {
+	value, err := binary.ReadUvarint(d.reader)
+	if err != nil {
+		return 0, NewDecodeDeltaError(NoEOF(err))
+	}
+	if value > math.MaxInt {
+		return 0, NewDecodeDeltaError(fmt.Errorf("value %d is out of range", value))
+	}
+	return int(value), nil
+}
+
+/*
+Turns io.EOF into io.ErrUnexpectedEOF. Signatures and deltas end with an explicit END, so running out of data
+before it means the file is truncated.
+*/
+func NoEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
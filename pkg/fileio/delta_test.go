@@ -0,0 +1,259 @@
+package fileio
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"testing"
+
+	"github.com/Psykepro/rdiff/pkg/differ"
+	"github.com/Psykepro/rdiff/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+// Signatures of original as the signature command records them, with the digest of the whole file.
+func signaturesOf(t *testing.T, chunkSize int, original []byte) *differ.SignatureTable {
+	signatures, err := differ.New(chunkSize).GenerateSignatures(bytes.NewReader(original))
+	assert.NoError(t, err)
+	digest := sha256.Sum256(original)
+	signatures.Digest = digest[:]
+	return signatures
+}
+
+// Ends the delta written by writer with the length and digest of updated.
+func closeDelta(t *testing.T, writer *DeltaWriter, updated []byte) {
+	digest := sha256.Sum256(updated)
+	assert.NoError(t, writer.WriteDigest(int64(len(updated)), digest[:]))
+	assert.NoError(t, writer.Close())
+}
+
+func TestDeltaWriter(t *testing.T) {
+	var buffer bytes.Buffer
+	writer, err := NewDeltaWriter(&buffer, signaturesOf(t, 16, []byte("original")))
+	assert.NoError(t, err)
+
+	assert.NoError(t, writer.WriteOp(differ.Copy(1, 300)))
+	assert.NoError(t, writer.WriteOp(differ.Literal([]byte("abc"))))
+	assert.NoError(t, writer.WriteOp(differ.CopyRange(200, 5)))
+
+	closeDelta(t, writer, []byte("updated"))
+
+	basisDigest := sha256.Sum256([]byte("original"))
+	targetDigest := sha256.Sum256([]byte("updated"))
+	expected := []byte{
+		'R', 'D', 'D', 'L', // magic
+		1,  // version
+		16, // chunk size
+		8,  // basis length
+		32, // basis digest length
+	}
+	expected = append(expected, basisDigest[:]...)
+	expected = append(expected,
+		opCopy, 1, 0xac, 0x02,
+		opLiteral, 3, 'a', 'b', 'c',
+		opCopyRange, 0xc8, 0x01, 5,
+		opEnd, 7,
+	)
+	expected = append(expected, targetDigest[:]...)
+	assert.Equal(t, expected, buffer.Bytes())
+}
+
+func TestDeltaWriterWithoutDigest(t *testing.T) {
+	var buffer bytes.Buffer
+	writer, err := NewDeltaWriter(&buffer, differ.NewSignatureTable(16, hash.Adler32, hash.BLAKE2b, 32, nil))
+	assert.NoError(t, err)
+	closeDelta(t, writer, nil)
+	assert.Equal(t, []byte{'R', 'D', 'D', 'L', 1, 16, 0, 0}, buffer.Bytes()[:8])
+
+	reader, err := NewDeltaReader(&buffer)
+	assert.NoError(t, err)
+	assert.Nil(t, reader.BasisDigest())
+	assert.Zero(t, reader.BasisLength())
+	// Without a digest only the length of the original file is checked
+	assert.NoError(t, reader.VerifyBasis(NewFileChecksum()))
+	basis := NewFileChecksum()
+	basis.Write([]byte("anything"))
+	assert.ErrorIs(t, reader.VerifyBasis(basis), ErrBasisMismatch)
+}
+
+func TestDeltaWriterWithoutTargetDigest(t *testing.T) {
+	writer, err := NewDeltaWriter(io.Discard, signaturesOf(t, 16, nil))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, writer.WriteDigest(7, []byte("short")), ErrEncodeDelta)
+	assert.ErrorIs(t, writer.Close(), ErrEncodeDelta)
+}
+
+func TestDeltaWriterSplitsLongLiterals(t *testing.T) {
+	literals := bytes.Repeat([]byte("a"), 2*MaxLiteralLength+1)
+
+	var buffer bytes.Buffer
+	writer, err := NewDeltaWriter(&buffer, signaturesOf(t, 16, nil))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.WriteOp(differ.Literal(literals)))
+	closeDelta(t, writer, nil)
+
+	reader, err := NewDeltaReader(&buffer)
+	assert.NoError(t, err)
+	var lengths []int
+	for {
+		op, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		lengths = append(lengths, len(op.Data))
+	}
+	assert.Equal(t, []int{MaxLiteralLength, MaxLiteralLength, 1}, lengths)
+}
+
+func TestDeltaReader(t *testing.T) {
+	delta := differ.Delta{
+		differ.Copy(0, 4),
+		differ.Literal([]byte("changes")),
+		differ.Copy(7, 1),
+		differ.CopyRange(1000, 300),
+	}
+	updated := []byte("updated file")
+
+	encode := func() []byte {
+		var buffer bytes.Buffer
+		writer, err := NewDeltaWriter(&buffer, signaturesOf(t, 32, bytes.Repeat([]byte("original"), 200)))
+		assert.NoError(t, err)
+		for _, op := range delta {
+			assert.NoError(t, writer.WriteOp(op))
+		}
+		closeDelta(t, writer, updated)
+		return buffer.Bytes()
+	}
+
+	testCases := []struct {
+		name         string
+		input        []byte
+		target       []byte
+		expectedErr  error
+		expectedVerr error
+	}{
+		{
+			name:   "Valid Delta",
+			input:  encode(),
+			target: updated,
+		},
+		{
+			name:         "Wrong Updated File",
+			input:        encode(),
+			target:       []byte("updated File"),
+			expectedVerr: ErrChecksumMismatch,
+		},
+		{
+			name:         "Truncated Updated File",
+			input:        encode(),
+			target:       updated[:4],
+			expectedVerr: ErrChecksumMismatch,
+		},
+		{
+			name:        "Truncated Delta",
+			input:       encode()[:len(encode())-5],
+			expectedErr: ErrDecodeDelta,
+		},
+		{
+			name:        "Missing End",
+			input:       encode()[:len(encode())-34],
+			expectedErr: ErrDecodeDelta,
+		},
+		{
+			name:        "Trailing Data",
+			input:       append(encode(), opEnd),
+			expectedErr: ErrDecodeDelta,
+		},
+		{
+			name:        "Unknown Opcode",
+			input:       append(encode()[:len(encode())-34], 0x7f),
+			expectedErr: ErrDecodeDelta,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader, err := NewDeltaReader(bytes.NewReader(tc.input))
+			assert.NoError(t, err)
+			assert.Equal(t, 32, reader.ChunkSize())
+
+			var decoded differ.Delta
+			for {
+				op, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					assert.ErrorIs(t, err, tc.expectedErr)
+					return
+				}
+				decoded = append(decoded, op)
+			}
+			assert.Nil(t, tc.expectedErr)
+			assert.Equal(t, delta, decoded)
+
+			target := NewFileChecksum()
+			target.Write(tc.target)
+			assert.ErrorIs(t, reader.Verify(target), tc.expectedVerr)
+		})
+	}
+}
+
+func TestDeltaReaderVerifyBasis(t *testing.T) {
+	original := []byte("This is the original file the delta was generated against")
+	var buffer bytes.Buffer
+	writer, err := NewDeltaWriter(&buffer, signaturesOf(t, 16, original))
+	assert.NoError(t, err)
+	closeDelta(t, writer, nil)
+
+	reader, err := NewDeltaReader(&buffer)
+	assert.NoError(t, err)
+	digest := sha256.Sum256(original)
+	assert.Equal(t, digest[:], reader.BasisDigest())
+
+	testCases := []struct {
+		name        string
+		basis       []byte
+		expectedErr error
+	}{
+		{name: "Same Original File", basis: original},
+		{name: "Changed Original File", basis: bytes.ToUpper(original), expectedErr: ErrBasisMismatch},
+		{name: "Truncated Original File", basis: original[:len(original)-1], expectedErr: ErrBasisMismatch},
+		{name: "Empty Original File", basis: nil, expectedErr: ErrBasisMismatch},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			basis := NewFileChecksum()
+			basis.Write(tc.basis)
+			assert.ErrorIs(t, reader.VerifyBasis(basis), tc.expectedErr)
+		})
+	}
+}
+
+func TestNewDeltaReader(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "Empty Input", input: []byte{}},
+		{name: "Invalid Magic", input: []byte("RDSG\x01\x10")},
+		{name: "Unsupported Version", input: []byte("RDDL\x02\x10")},
+		{name: "Invalid Chunk Size", input: []byte("RDDL\x01\x00")},
+		{name: "Chunk Size Too Large", input: []byte("RDDL\x01\x81\x80\x80\x80\x04\x08\x00")},
+		{name: "Missing Chunk Size", input: []byte("RDDL\x01")},
+		{name: "Missing Basis Length", input: []byte("RDDL\x01\x10")},
+		{name: "Missing Digest Length", input: []byte("RDDL\x01\x10\x08")},
+		{name: "Invalid Digest Length", input: []byte("RDDL\x01\x10\x08\x14")},
+		{name: "Truncated Digest", input: []byte("RDDL\x01\x10\x08\x20abc")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader, err := NewDeltaReader(bytes.NewReader(tc.input))
+			assert.ErrorIs(t, err, ErrDecodeDelta)
+			assert.Nil(t, reader)
+		})
+	}
+}
@@ -3,23 +3,82 @@ package fileio
 import (
 	"errors"
 	"fmt"
+	"io/fs"
+	"os"
 )
 
 var (
 	ErrReadFile         = fmt.Errorf("error in reading file")
-	ErrFileSize         = fmt.Errorf("file is not of appropriate size to generate enough chunks")
 	ErrCreateFile       = fmt.Errorf("error in creating file")
+	ErrWriteFile        = fmt.Errorf("error in writing file")
 	ErrEncodeSignatures = fmt.Errorf("error in encoding signatures")
 	ErrDecodeSignatures = fmt.Errorf("error in decoding signatures")
 	ErrEncodeDelta      = fmt.Errorf("error in encoding delta")
 	ErrDecodeDelta      = fmt.Errorf("error in decoding delta")
+	ErrChecksumMismatch = fmt.Errorf("updated file does not match the length and checksum stored in the delta")
+	ErrBasisMismatch    = fmt.Errorf("original file does not match the length and digest stored in the delta")
 )
 
+/*
+Error of an operation on a file, returned by every FileHandler method and by OpenFile and CreateFile. Err wraps
+both one of the errors above and the root cause, so errors.Is(err, ErrDecodeDelta) holds while errors.Is and
+errors.As still reach the error of the file system or a *differ.CanceledError.
+*/
+type Error struct {
+	Op   string // Operation which failed: open, create, read signatures, write signatures, read delta or write delta
+	Path string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Op + " " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Returns the cause of an *fs.PathError or *os.LinkError without their paths, since the *Error holding the cause already names the file.
+func PathErrorCause(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return linkErr.Err
+	}
+	return err
+}
+
 func NewReadFileError(err error) error {
-	return fmt.Errorf("%w. Error Details: %v", ErrReadFile, err)
+	return fmt.Errorf("%w. Error Details: %w", ErrReadFile, err)
+}
+
+func NewCreateFileError(err error) error {
+	return fmt.Errorf("%w. Error Details: %w", ErrCreateFile, err)
+}
+
+func NewWriteFileError(err error) error {
+	return fmt.Errorf("%w. Error Details: %w", ErrWriteFile, err)
+}
+
+func NewEncodeSignaturesError(err error) error {
+	return fmt.Errorf("%w. Error Details: %w", ErrEncodeSignatures, err)
+}
+
+func NewDecodeSignaturesError(err error) error {
+	return fmt.Errorf("%w. Error Details: %w", ErrDecodeSignatures, err)
+}
+
+func NewEncodeDeltaError(err error) error {
+	return fmt.Errorf("%w. Error Details: %w", ErrEncodeDelta, err)
+}
+
+func NewDecodeDeltaError(err error) error {
+	return fmt.Errorf("%w. Error Details: %w", ErrDecodeDelta, err)
 }
 
-// fmt.Errorf("open " + nonExistentPath + ": no such file or directory")
-func NewOpenFileError(fileName string) error {
-	return fmt.Errorf("open %v: no such file or directory", errors.New(fileName))
+func NewBasisMismatchError(err error) error {
+	return fmt.Errorf("%w. Error Details: %w", ErrBasisMismatch, err)
 }
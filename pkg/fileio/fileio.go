@@ -2,12 +2,17 @@ package fileio
 
 import (
 	"bufio"
-	"encoding/gob"
+	"context"
+	"fmt"
+	"io"
 	"os"
 
 	"github.com/Psykepro/rdiff/pkg/differ"
 )
 
+// Path standing for the standard input when reading and for the standard output when writing.
+const StdStream = "-"
+
 type FileHandler struct {
 	chunkSize int
 }
@@ -22,85 +27,172 @@ func (f FileHandler) ChunkSize() int {
 	return f.chunkSize
 }
 
-func (f FileHandler) Open(filepath string) (*bufio.Reader, error) {
+/*
+Opens the file at filepath for buffered reading, or the standard input for StdStream. Files of any size can be read,
+including empty ones. Closing the reader closes the file, but not the standard input.
+*/
+func (f FileHandler) Open(filepath string) (io.ReadCloser, error) {
+	if filepath == StdStream {
+		return bufferedFile{bufio.NewReader(os.Stdin), io.NopCloser(os.Stdin)}, nil
+	}
 	file, err := os.Open(filepath)
 	if err != nil {
-		return nil, NewReadFileError(err)
+		return nil, &Error{Op: "open", Path: filepath, Err: NewReadFileError(PathErrorCause(err))}
 	}
+	return bufferedFile{bufio.NewReader(file), file}, nil
+}
 
-	fileInfo, _ := file.Stat()
-	size := fileInfo.Size()
+// Reads an opened file through a buffer and closes the file itself.
+type bufferedFile struct {
+	*bufio.Reader
+	io.Closer
+}
 
-	chunks := size / int64(f.chunkSize)
-	if chunks < 2 {
-		return nil, ErrFileSize
+// Opens the file at filepath for reading, or the standard input for StdStream.
+func OpenFile(filepath string) (io.ReadCloser, error) {
+	if filepath == StdStream {
+		return io.NopCloser(os.Stdin), nil
+	}
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, &Error{Op: "open", Path: filepath, Err: NewReadFileError(PathErrorCause(err))}
 	}
-	return bufio.NewReader(file), nil
+	return file, nil
 }
 
-func (f FileHandler) WriteSignatures(signatures map[uint]int, output string) error {
-	file, err := os.Create(output)
+// Creates the file at filepath, or returns the standard output for StdStream. Closing the standard output does nothing.
+func CreateFile(filepath string) (io.WriteCloser, error) {
+	if filepath == StdStream {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	file, err := os.Create(filepath)
 	if err != nil {
-		return err
+		return nil, &Error{Op: "create", Path: filepath, Err: NewCreateFileError(PathErrorCause(err))}
 	}
-	defer file.Close()
+	return file, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func (f FileHandler) WriteSignatures(signatures *differ.SignatureTable, output string) error {
+	return f.WriteSignaturesContext(context.Background(), signatures, output)
+}
 
-	encoder := gob.NewEncoder(file)
-	err = encoder.Encode(signatures)
+// Writes the signatures like WriteSignatures, and stops with a *differ.CanceledError once ctx is done.
+func (f FileHandler) WriteSignaturesContext(ctx context.Context, signatures *differ.SignatureTable, output string) error {
+	file, err := CreateFile(output)
 	if err != nil {
 		return err
 	}
 
+	writer := NewContextWriter(ctx, file)
+	if err := writer.Cause(EncodeSignatures(writer, signatures)); err != nil {
+		file.Close()
+		return &Error{Op: "write signatures", Path: output, Err: err}
+	}
+	return closeOutput(file, "write signatures", output)
+}
+
+// Closes a written file, whose last writes may only fail when it is closed.
+func closeOutput(file io.Closer, op, path string) error {
+	if err := file.Close(); err != nil {
+		return &Error{Op: op, Path: path, Err: NewWriteFileError(PathErrorCause(err))}
+	}
 	return nil
 }
 
-func (f FileHandler) ReadSignatures(filePath string) (map[uint]int, error) {
-	signatures := make(map[uint]int)
+func (f FileHandler) ReadSignatures(filePath string) (*differ.SignatureTable, error) {
+	return f.ReadSignaturesContext(context.Background(), filePath)
+}
 
-	file, err := os.Open(filePath)
+// Reads the signatures like ReadSignatures, and stops with a *differ.CanceledError once ctx is done.
+func (f FileHandler) ReadSignaturesContext(ctx context.Context, filePath string) (*differ.SignatureTable, error) {
+	file, err := OpenFile(filePath)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	decoder := gob.NewDecoder(file)
-	err = decoder.Decode(&signatures)
+	reader := NewContextReader(ctx, file)
+	signatures, err := DecodeSignatures(reader)
 	if err != nil {
-		return nil, err
+		return nil, &Error{Op: "read signatures", Path: filePath, Err: reader.Cause(err)}
 	}
-
 	return signatures, nil
 }
 
-func (f FileHandler) WriteDelta(delta map[int]differ.Delta, output string) error {
-	file, err := os.Create(output)
+// Writes delta, generated against the original file of signatures, along with the length and digest of the updated file.
+func (f FileHandler) WriteDelta(signatures *differ.SignatureTable, delta differ.Delta, target *FileChecksum, output string) error {
+	return f.WriteDeltaContext(context.Background(), signatures, delta, target, output)
+}
+
+// Writes the delta like WriteDelta, and stops with a *differ.CanceledError once ctx is done.
+func (f FileHandler) WriteDeltaContext(ctx context.Context, signatures *differ.SignatureTable, delta differ.Delta, target *FileChecksum, output string) error {
+	file, err := CreateFile(output)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	encoder := gob.NewEncoder(file)
-	err = encoder.Encode(delta)
+	contextWriter := NewContextWriter(ctx, file)
+	if err := writeDelta(contextWriter, signatures, delta, target); err != nil {
+		file.Close()
+		return &Error{Op: "write delta", Path: output, Err: contextWriter.Cause(err)}
+	}
+	return closeOutput(file, "write delta", output)
+}
+
+func writeDelta(w io.Writer, signatures *differ.SignatureTable, delta differ.Delta, target *FileChecksum) error {
+	if target == nil {
+		return NewEncodeDeltaError(fmt.Errorf("no checksum of the updated file"))
+	}
+	writer, err := NewDeltaWriter(w, signatures)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	for _, op := range delta {
+		if err := writer.WriteOp(op); err != nil {
+			return err
+		}
+	}
+	if err := writer.WriteDigest(target.Length(), target.Digest()); err != nil {
+		return err
+	}
+	return writer.Close()
 }
 
-func (f FileHandler) ReadDelta(filePath string) (map[int]differ.Delta, error) {
-	delta := make(map[int]differ.Delta)
+func (f FileHandler) ReadDelta(filePath string) (differ.Delta, error) {
+	return f.ReadDeltaContext(context.Background(), filePath)
+}
 
-	file, err := os.Open(filePath)
+// Reads the delta like ReadDelta, and stops with a *differ.CanceledError once ctx is done.
+func (f FileHandler) ReadDeltaContext(ctx context.Context, filePath string) (differ.Delta, error) {
+	file, err := OpenFile(filePath)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	decoder := gob.NewDecoder(file)
-	err = decoder.Decode(&delta)
+	contextReader := NewContextReader(ctx, file)
+	reader, err := NewDeltaReader(contextReader)
 	if err != nil {
-		return nil, ErrDecodeDelta
+		return nil, &Error{Op: "read delta", Path: filePath, Err: contextReader.Cause(err)}
+	}
+	delta := differ.Delta{}
+	for {
+		op, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &Error{Op: "read delta", Path: filePath, Err: contextReader.Cause(err)}
+		}
+		delta = append(delta, op)
 	}
 
 	return delta, nil
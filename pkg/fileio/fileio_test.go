@@ -1,12 +1,17 @@
 package fileio
 
 import (
-	"encoding/gob"
+	"context"
 	"errors"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/Psykepro/rdiff/pkg/differ"
+	"github.com/Psykepro/rdiff/pkg/hash"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,6 +20,9 @@ const (
 	nonExistingPath = "nonExistingPath"
 )
 
+// Signatures of an empty original file without a digest, which deltas can be written against
+var emptySignatures = differ.NewSignatureTable(16, hash.Adler32, hash.BLAKE2b, 32, nil)
+
 func TestNewFileHandler(t *testing.T) {
 	fileHandler := NewFileHandler(16)
 	assert.Equal(t, 16, fileHandler.ChunkSize())
@@ -39,16 +47,28 @@ func TestOpen(t *testing.T) {
 			expectedErr: nil,
 		},
 		{
-			name:        "Not Enough Chunks",
+			name:        "Smaller Than Two Chunks",
 			chunkSize:   1500,
 			filePath:    validFilePath,
-			expectedErr: ErrFileSize,
+			expectedErr: nil,
+		},
+		{
+			name:        "Non-Regular File",
+			chunkSize:   1500,
+			filePath:    "/dev/null",
+			expectedErr: nil,
+		},
+		{
+			name:        "Standard Input",
+			chunkSize:   1500,
+			filePath:    StdStream,
+			expectedErr: nil,
 		},
 		{
 			name:        "Error Opening File",
 			chunkSize:   16,
 			filePath:    nonExistingPath,
-			expectedErr: NewReadFileError(errors.New("open " + nonExistingPath + ": no such file or directory")),
+			expectedErr: &Error{Op: "open", Path: nonExistingPath, Err: NewReadFileError(errors.New("no such file or directory"))},
 		},
 	}
 
@@ -63,24 +83,51 @@ func TestOpen(t *testing.T) {
 			} else {
 				assert.NotNil(t, reader)
 				assert.Nil(t, err)
+				assert.NoError(t, reader.Close())
 			}
 		})
 	}
 }
 
+func TestStdStream(t *testing.T) {
+	reader, err := OpenFile(StdStream)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+
+	writer, err := CreateFile(StdStream)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	// Closing the standard output stream must not close the standard output itself
+	_, err = os.Stdout.Stat()
+	assert.NoError(t, err)
+}
+
 func TestWriteAndReadSignatures(t *testing.T) {
 	testCases := []struct {
 		name        string
-		signatures  map[uint]int
+		signatures  *differ.SignatureTable
 		expectedErr error
 	}{
 		{
 			name: "Valid Signatures",
-			signatures: map[uint]int{
-				1: 0,
-				2: 16,
-				3: 32,
-			},
+			signatures: differ.NewSignatureTable(16, hash.Adler32, hash.SHA256, 4, []differ.Block{
+				{Index: 0, Offset: 0, Length: 16, WeakHash: 1, StrongHash: []byte{1, 2, 3, 4}},
+				{Index: 1, Offset: 16, Length: 16, WeakHash: 2, StrongHash: []byte{5, 6, 7, 8}},
+				{Index: 2, Offset: 32, Length: 16, WeakHash: 1, StrongHash: []byte{9, 10, 11, 12}},
+				{Index: 3, Offset: 48, Length: 7, WeakHash: 3, StrongHash: []byte{13, 14, 15, 16}},
+			}),
+			expectedErr: nil,
+		},
+		{
+			name:        "Empty File Signatures",
+			signatures:  differ.NewSignatureTable(16, hash.Adler32, hash.BLAKE2b, 32, nil),
+			expectedErr: nil,
+		},
+		{
+			name: "Single Short Chunk",
+			signatures: differ.NewSignatureTable(16, hash.Adler32, hash.SHA256, 4, []differ.Block{
+				{Index: 0, Offset: 0, Length: 3, WeakHash: 1, StrongHash: []byte{1, 2, 3, 4}},
+			}),
 			expectedErr: nil,
 		},
 	}
@@ -105,17 +152,22 @@ func TestWriteAndReadSignatures(t *testing.T) {
 func TestWriteDelta(t *testing.T) {
 	testCases := []struct {
 		name        string
-		delta       map[int]differ.Delta
+		delta       differ.Delta
 		expectedErr error
 	}{
 		{
 			name: "Valid Delta",
-			delta: map[int]differ.Delta{
-				0: {StartIndex: 0, EndIndex: 16, Deleted: false, UpdatedLiterals: []byte("Updated content")},
-				1: {StartIndex: 16, EndIndex: 32, Deleted: true},
+			delta: differ.Delta{
+				differ.Literal([]byte("Updated content")),
+				differ.Copy(1, 2),
 			},
 			expectedErr: nil,
 		},
+		{
+			name:        "Empty Delta",
+			delta:       differ.Delta{},
+			expectedErr: nil,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -125,7 +177,7 @@ func TestWriteDelta(t *testing.T) {
 			defer os.Remove(file.Name())
 
 			fileHandler := NewFileHandler(16)
-			err = fileHandler.WriteDelta(tc.delta, file.Name())
+			err = fileHandler.WriteDelta(emptySignatures, tc.delta, NewFileChecksum(), file.Name())
 			assert.Equal(t, tc.expectedErr, err)
 		})
 	}
@@ -134,22 +186,22 @@ func TestWriteDelta(t *testing.T) {
 func TestReadDelta(t *testing.T) {
 	testCases := []struct {
 		name        string
-		delta       map[int]differ.Delta
+		delta       differ.Delta
 		isInvalid   bool
 		expectedErr error
 	}{
 		{
 			name: "Valid Delta",
-			delta: map[int]differ.Delta{
-				0: {StartIndex: 0, EndIndex: 16, Deleted: false, UpdatedLiterals: []byte("Updated content")},
-				1: {StartIndex: 16, EndIndex: 32, Deleted: true},
+			delta: differ.Delta{
+				differ.Literal([]byte("Updated content")),
+				differ.Copy(1, 2),
 			},
 			expectedErr: nil,
 		},
 		{
 			name:        "Non-existent File",
 			delta:       nil,
-			expectedErr: NewOpenFileError(nonExistingPath),
+			expectedErr: fs.ErrNotExist,
 		},
 		{
 			name:        "Invalid Delta File",
@@ -168,13 +220,11 @@ func TestReadDelta(t *testing.T) {
 				deltaFile = file.Name()
 				defer os.Remove(deltaFile)
 				fileHandler := NewFileHandler(16)
-				err = fileHandler.WriteDelta(tc.delta, deltaFile)
+				err = fileHandler.WriteDelta(emptySignatures, tc.delta, NewFileChecksum(), deltaFile)
 				assert.NoError(t, err)
 				if tc.isInvalid {
 					// Write invalid data to the file
-					file.Seek(0, 0)
-					encoder := gob.NewEncoder(file)
-					err = encoder.Encode("invalid delta data")
+					_, err = file.WriteAt([]byte("invalid delta data"), 0)
 					assert.NoError(t, err)
 				}
 			} else {
@@ -185,8 +235,11 @@ func TestReadDelta(t *testing.T) {
 			readDelta, err := fileHandler.ReadDelta(deltaFile)
 
 			if tc.expectedErr != nil {
-				assert.Error(t, err)
-				assert.Equal(t, tc.expectedErr.Error(), err.Error())
+				assert.ErrorIs(t, err, tc.expectedErr)
+				var fileErr *Error
+				if assert.ErrorAs(t, err, &fileErr) {
+					assert.Equal(t, deltaFile, fileErr.Path)
+				}
 				assert.Nil(t, readDelta)
 			} else {
 				assert.NoError(t, err)
@@ -195,3 +248,193 @@ func TestReadDelta(t *testing.T) {
 		})
 	}
 }
+
+func TestFileHandlerContext(t *testing.T) {
+	signatures := differ.NewSignatureTable(16, hash.Adler32, hash.SHA256, 4, []differ.Block{
+		{Index: 0, Offset: 0, Length: 16, WeakHash: 1, StrongHash: []byte{1, 2, 3, 4}},
+	})
+	delta := differ.Delta{differ.Literal([]byte("Updated content")), differ.Copy(1, 2)}
+
+	directory := t.TempDir()
+	signatureFile := filepath.Join(directory, "signatures")
+	deltaFile := filepath.Join(directory, "delta")
+	fileHandler := NewFileHandler(16)
+	assert.NoError(t, fileHandler.WriteSignatures(signatures, signatureFile))
+	assert.NoError(t, fileHandler.WriteDelta(signatures, delta, NewFileChecksum(), deltaFile))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	testCases := []struct {
+		name string
+		run  func() error
+	}{
+		{
+			name: "Write Signatures",
+			run: func() error {
+				return fileHandler.WriteSignaturesContext(ctx, signatures, filepath.Join(directory, "canceled.sig"))
+			},
+		},
+		{
+			name: "Read Signatures",
+			run: func() error {
+				_, err := fileHandler.ReadSignaturesContext(ctx, signatureFile)
+				return err
+			},
+		},
+		{
+			name: "Write Delta",
+			run: func() error {
+				return fileHandler.WriteDeltaContext(ctx, signatures, delta, NewFileChecksum(), filepath.Join(directory, "canceled.delta"))
+			},
+		},
+		{
+			name: "Read Delta",
+			run: func() error {
+				_, err := fileHandler.ReadDeltaContext(ctx, deltaFile)
+				return err
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.run()
+			assert.ErrorIs(t, err, context.Canceled)
+			var canceled *differ.CanceledError
+			assert.ErrorAs(t, err, &canceled)
+		})
+	}
+}
+
+func TestContextReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := NewContextReader(ctx, strings.NewReader("0123456789"))
+
+	buffer := make([]byte, 4)
+	n, err := reader.Read(buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	cancel()
+	n, err = reader.Read(buffer)
+	assert.Zero(t, n)
+	var canceled *differ.CanceledError
+	if assert.ErrorAs(t, err, &canceled) {
+		assert.Equal(t, int64(4), canceled.Processed)
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+	assert.Nil(t, reader.Cause(nil))
+	assert.Equal(t, err.Error(), reader.Cause(ErrDecodeDelta).Error())
+}
+
+func TestFileHandlerErrors(t *testing.T) {
+	directory := t.TempDir()
+	deltaFile := filepath.Join(directory, "delta")
+	fileHandler := NewFileHandler(16)
+	assert.NoError(t, fileHandler.WriteDelta(emptySignatures, differ.Delta{differ.Literal([]byte("Updated content"))}, NewFileChecksum(), deltaFile))
+	truncatedFile := filepath.Join(directory, "truncated")
+	data, err := os.ReadFile(deltaFile)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(truncatedFile, data[:len(data)-4], 0o644))
+	missingDirectory := filepath.Join(directory, "missing", "output")
+
+	testCases := []struct {
+		name        string
+		run         func() error
+		op          string
+		path        string
+		expectedErr error
+		cause       error
+	}{
+		{
+			name: "Create Signature File",
+			run: func() error {
+				return fileHandler.WriteSignatures(differ.NewSignatureTable(16, hash.Adler32, hash.BLAKE2b, 32, nil), missingDirectory)
+			},
+			op:          "create",
+			path:        missingDirectory,
+			expectedErr: ErrCreateFile,
+			cause:       fs.ErrNotExist,
+		},
+		{
+			name: "Create Delta File",
+			run: func() error {
+				return fileHandler.WriteDelta(emptySignatures, differ.Delta{}, NewFileChecksum(), missingDirectory)
+			},
+			op:          "create",
+			path:        missingDirectory,
+			expectedErr: ErrCreateFile,
+			cause:       fs.ErrNotExist,
+		},
+		{
+			name: "Open Signature File",
+			run: func() error {
+				_, err := fileHandler.ReadSignatures(missingDirectory)
+				return err
+			},
+			op:          "open",
+			path:        missingDirectory,
+			expectedErr: ErrReadFile,
+			cause:       fs.ErrNotExist,
+		},
+		{
+			name: "Decode Signatures",
+			run: func() error {
+				_, err := fileHandler.ReadSignatures(deltaFile)
+				return err
+			},
+			op:          "read signatures",
+			path:        deltaFile,
+			expectedErr: ErrDecodeSignatures,
+		},
+		{
+			name: "Decode Truncated Delta",
+			run: func() error {
+				_, err := fileHandler.ReadDelta(truncatedFile)
+				return err
+			},
+			op:          "read delta",
+			path:        truncatedFile,
+			expectedErr: ErrDecodeDelta,
+			cause:       io.ErrUnexpectedEOF,
+		},
+		{
+			name: "Encode Delta",
+			run: func() error {
+				return fileHandler.WriteDelta(emptySignatures, differ.Delta{{Type: differ.OpType(99)}}, NewFileChecksum(), filepath.Join(directory, "invalid"))
+			},
+			op:          "write delta",
+			path:        filepath.Join(directory, "invalid"),
+			expectedErr: ErrEncodeDelta,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.run()
+			assert.ErrorIs(t, err, tc.expectedErr)
+			if tc.cause != nil {
+				assert.ErrorIs(t, err, tc.cause)
+			}
+			var fileErr *Error
+			if assert.ErrorAs(t, err, &fileErr) {
+				assert.Equal(t, tc.op, fileErr.Op)
+				assert.Equal(t, tc.path, fileErr.Path)
+			}
+		})
+	}
+}
+
+func TestPathErrorCause(t *testing.T) {
+	_, openErr := os.Open(nonExistingPath)
+	renameErr := os.Rename(nonExistingPath, filepath.Join(t.TempDir(), "renamed"))
+	for _, err := range []error{openErr, renameErr} {
+		cause := PathErrorCause(err)
+		assert.ErrorIs(t, cause, fs.ErrNotExist)
+		assert.NotContains(t, cause.Error(), nonExistingPath)
+	}
+
+	err := errors.New("no path")
+	assert.Equal(t, err, PathErrorCause(err))
+}
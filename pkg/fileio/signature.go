@@ -0,0 +1,335 @@
+package fileio
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/Psykepro/rdiff/pkg/differ"
+	"github.com/Psykepro/rdiff/pkg/hash"
+)
+
+/*
+Signature file format, all integers are big endian:
+
+	offset  size  field
+	0       4     magic "RDSG"
+	4       1     format version
+	5       1     weak hash id
+	6       1     strong hash id
+	7       1     strong hash length in bytes
+	8       4     chunk size in bytes
+	12            sequence of records, each starting with its 1 byte tag:
+	                0x01 CHUNK        4 byte weak hash, strong hash truncated to its length
+	                0x02 CHUNKING     minimum chunk size 4 bytes, maximum chunk size 4 bytes
+	                0x03 SIZED CHUNK  4 byte length, 4 byte weak hash, strong hash truncated to its length
+	                0x04 DIGEST       SHA-256 digest of the original file, 32 bytes
+	                0x00 END          length of the original file, 8 bytes
+
+There is one CHUNK record per chunk of the original file, in order, and END is always the last record.
+The offset and length of each chunk follow from the chunk size and the length of the original file,
+which is only stored at the end so that signatures can be written while the original file is read.
+For the same reason the DIGEST record comes right before END. It is left out when the digest is not known.
+
+Content-defined chunks start with a CHUNKING record right after the header, and the chunk size of the header
+is their average length. Their lengths vary, so every chunk is a SIZED CHUNK record holding its own length.
+*/
+const (
+	SignatureMagic   = "RDSG"
+	SignatureVersion = 1
+
+	signatureHeaderSize = 12
+
+	// Largest chunk size signatures and deltas are decoded with, the same bound librsync uses, so that
+	// a corrupted header cannot make the differ allocate gigabytes for a single chunk
+	MaxChunkSize = 1 << 30
+)
+
+const (
+	recordEnd        byte = 0x00
+	recordChunk      byte = 0x01
+	recordChunking   byte = 0x02
+	recordSizedChunk byte = 0x03
+	recordDigest     byte = 0x04
+)
+
+// Encodes signatures chunk by chunk.
+type SignatureWriter struct {
+	writer       *bufio.Writer
+	record       []byte
+	strongLength int
+	sized        bool
+	fileSize     int64
+	digest       []byte
+}
+
+// Creates a signature writer for the chunk size and hashes of signatures and writes the header. The blocks of signatures are not written.
+func NewSignatureWriter(w io.Writer, signatures *differ.SignatureTable) (*SignatureWriter, error) {
+	s := &SignatureWriter{
+		writer:       bufio.NewWriter(w),
+		record:       make([]byte, 1+4+signatures.StrongLength, 1+4+4+signatures.StrongLength),
+		strongLength: signatures.StrongLength,
+		sized:        signatures.ContentDefined(),
+	}
+
+	header := make([]byte, signatureHeaderSize)
+	copy(header, SignatureMagic)
+	header[4] = SignatureVersion
+	header[5] = byte(signatures.WeakHash)
+	header[6] = byte(signatures.StrongHash)
+	header[7] = byte(signatures.StrongLength)
+	binary.BigEndian.PutUint32(header[8:], uint32(signatures.ChunkSize))
+	if s.sized {
+		header = append(header, recordChunking)
+		header = binary.BigEndian.AppendUint32(header, uint32(signatures.MinChunkSize))
+		header = binary.BigEndian.AppendUint32(header, uint32(signatures.MaxChunkSize))
+		s.record = s.record[:cap(s.record)]
+	}
+	if _, err := s.writer.Write(header); err != nil {
+		return nil, NewEncodeSignaturesError(err)
+	}
+	return s, nil
+}
+
+func (s *SignatureWriter) WriteBlock(block differ.Block) error {
+	if len(block.StrongHash) != s.strongLength {
+		return NewEncodeSignaturesError(fmt.Errorf("strong hash of chunk %d is %d bytes long instead of %d", block.Index, len(block.StrongHash), s.strongLength))
+	}
+	record := s.record[1:]
+	if s.sized {
+		s.record[0] = recordSizedChunk
+		binary.BigEndian.PutUint32(record, uint32(block.Length))
+		record = record[4:]
+	} else {
+		s.record[0] = recordChunk
+	}
+	binary.BigEndian.PutUint32(record, block.WeakHash)
+	copy(record[4:], block.StrongHash)
+	if _, err := s.writer.Write(s.record); err != nil {
+		return NewEncodeSignaturesError(err)
+	}
+	s.fileSize = block.Offset + int64(block.Length)
+	return nil
+}
+
+// Keeps the digest of the original file, which Close writes right before the END record.
+func (s *SignatureWriter) WriteDigest(length int64, digest []byte) error {
+	if len(digest) != sha256.Size {
+		return NewEncodeSignaturesError(fmt.Errorf("digest of the original file is %d bytes long instead of %d", len(digest), sha256.Size))
+	}
+	s.digest = digest
+	return nil
+}
+
+// Writes the DIGEST record when the digest of the original file is known, the END record with its length and flushes the signatures.
+func (s *SignatureWriter) Close() error {
+	var end []byte
+	if s.digest != nil {
+		end = append(end, recordDigest)
+		end = append(end, s.digest...)
+	}
+	end = append(end, recordEnd)
+	end = binary.BigEndian.AppendUint64(end, uint64(s.fileSize))
+	if _, err := s.writer.Write(end); err != nil {
+		return NewEncodeSignaturesError(err)
+	}
+	if err := s.writer.Flush(); err != nil {
+		return NewEncodeSignaturesError(err)
+	}
+	return nil
+}
+
+func EncodeSignatures(w io.Writer, signatures *differ.SignatureTable) error {
+	writer, err := NewSignatureWriter(w, signatures)
+	if err != nil {
+		return err
+	}
+	for _, block := range signatures.Blocks {
+		if err := writer.WriteBlock(block); err != nil {
+			return err
+		}
+	}
+	if signatures.Digest != nil {
+		if err := writer.WriteDigest(signatures.FileSize(), signatures.Digest); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func DecodeSignatures(r io.Reader) (*differ.SignatureTable, error) {
+	reader := bufio.NewReader(r)
+
+	header := make([]byte, signatureHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, NewDecodeSignaturesError(err)
+	}
+	if string(header[:4]) != SignatureMagic {
+		return nil, NewDecodeSignaturesError(fmt.Errorf("not a signature file"))
+	}
+	if version := header[4]; version != SignatureVersion {
+		return nil, NewDecodeSignaturesError(fmt.Errorf("unsupported version %d", version))
+	}
+
+	weakHash := hash.WeakHash(header[5])
+	strongHash := hash.StrongHash(header[6])
+	strongLength := int(header[7])
+	chunkSize := int(binary.BigEndian.Uint32(header[8:]))
+	switch {
+	case !weakHash.Valid():
+		return nil, NewDecodeSignaturesError(fmt.Errorf("unknown weak hash %v", weakHash))
+	case !strongHash.Valid():
+		return nil, NewDecodeSignaturesError(fmt.Errorf("unknown strong hash %v", strongHash))
+	case strongLength < 1 || strongLength > strongHash.Size():
+		return nil, NewDecodeSignaturesError(fmt.Errorf("invalid strong hash length %d", strongLength))
+	case chunkSize < 1 || chunkSize > MaxChunkSize:
+		return nil, NewDecodeSignaturesError(fmt.Errorf("invalid chunk size %d", chunkSize))
+	}
+
+	signatures := differ.NewSignatureTable(chunkSize, weakHash, strongHash, strongLength, nil)
+	var err error
+	if tag, _ := reader.Peek(1); len(tag) > 0 && tag[0] == recordChunking {
+		reader.ReadByte()
+		err = decodeSizedChunkRecords(reader, signatures)
+	} else {
+		err = decodeSignatureRecords(reader, signatures)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := reader.ReadByte(); err != io.EOF {
+		return nil, NewDecodeSignaturesError(fmt.Errorf("unexpected data after the last chunk"))
+	}
+	return signatures, nil
+}
+
+/*
+Reads the records of content-defined chunks until the END record. The CHUNKING record comes first
+and is followed by SIZED CHUNK records, whose lengths have to add up to the length of the original file.
+*/
+func decodeSizedChunkRecords(reader *bufio.Reader, signatures *differ.SignatureTable) error {
+	chunking := make([]byte, 8)
+	if _, err := io.ReadFull(reader, chunking); err != nil {
+		return NewDecodeSignaturesError(NoEOF(err))
+	}
+	signatures.MinChunkSize = int(binary.BigEndian.Uint32(chunking))
+	signatures.MaxChunkSize = int(binary.BigEndian.Uint32(chunking[4:]))
+	if signatures.MinChunkSize < 1 || signatures.MinChunkSize > signatures.ChunkSize || signatures.MaxChunkSize < signatures.ChunkSize || signatures.MaxChunkSize > MaxChunkSize {
+		return NewDecodeSignaturesError(fmt.Errorf("invalid chunk sizes %d to %d with average %d", signatures.MinChunkSize, signatures.MaxChunkSize, signatures.ChunkSize))
+	}
+
+	record := make([]byte, 4+4+signatures.StrongLength)
+	var offset int64
+	for {
+		tag, err := reader.ReadByte()
+		if err != nil {
+			return NewDecodeSignaturesError(NoEOF(err))
+		}
+		switch tag {
+		case recordSizedChunk:
+			if _, err := io.ReadFull(reader, record); err != nil {
+				return NewDecodeSignaturesError(NoEOF(err))
+			}
+			length := int(binary.BigEndian.Uint32(record))
+			if length < 1 || length > signatures.MaxChunkSize {
+				return NewDecodeSignaturesError(fmt.Errorf("chunk %d is %d bytes long", signatures.Len(), length))
+			}
+			signatures.Add(differ.Block{
+				Index:      signatures.Len(),
+				Offset:     offset,
+				Length:     length,
+				WeakHash:   binary.BigEndian.Uint32(record[4:]),
+				StrongHash: append([]byte(nil), record[8:]...),
+			})
+			offset += int64(length)
+		case recordDigest:
+			if err := decodeDigestRecord(reader, signatures); err != nil {
+				return err
+			}
+		case recordEnd:
+			end := make([]byte, 8)
+			if _, err := io.ReadFull(reader, end); err != nil {
+				return NewDecodeSignaturesError(NoEOF(err))
+			}
+			if fileSize := int64(binary.BigEndian.Uint64(end)); fileSize != offset {
+				return NewDecodeSignaturesError(fmt.Errorf("file size %d does not match %d chunks of %d bytes", fileSize, signatures.Len(), offset))
+			}
+			return nil
+		default:
+			return NewDecodeSignaturesError(fmt.Errorf("unknown record 0x%02x", tag))
+		}
+	}
+}
+
+/*
+Reads CHUNK records until the END record. The length of a chunk is only known once the length of the
+original file is read, so every chunk is added to signatures when the record after it is read.
+*/
+func decodeSignatureRecords(reader *bufio.Reader, signatures *differ.SignatureTable) error {
+	chunkSize := int64(signatures.ChunkSize)
+	record := make([]byte, 4+signatures.StrongLength)
+	var pending *differ.Block
+	for {
+		tag, err := reader.ReadByte()
+		if err != nil {
+			return NewDecodeSignaturesError(NoEOF(err))
+		}
+		switch tag {
+		case recordChunk:
+			if _, err := io.ReadFull(reader, record); err != nil {
+				return NewDecodeSignaturesError(NoEOF(err))
+			}
+			if pending != nil {
+				signatures.Add(*pending)
+			}
+			index := signatures.Len()
+			pending = &differ.Block{
+				Index:      index,
+				Offset:     int64(index) * chunkSize,
+				Length:     int(chunkSize),
+				WeakHash:   binary.BigEndian.Uint32(record),
+				StrongHash: append([]byte(nil), record[4:]...),
+			}
+		case recordDigest:
+			if err := decodeDigestRecord(reader, signatures); err != nil {
+				return err
+			}
+		case recordEnd:
+			end := make([]byte, 8)
+			if _, err := io.ReadFull(reader, end); err != nil {
+				return NewDecodeSignaturesError(NoEOF(err))
+			}
+			fileSize := int64(binary.BigEndian.Uint64(end))
+			if pending == nil {
+				if fileSize != 0 {
+					return NewDecodeSignaturesError(fmt.Errorf("file size %d without chunks", fileSize))
+				}
+				return nil
+			}
+			// The last chunk is the only one which may be shorter than the chunk size
+			if fileSize <= pending.Offset || fileSize > pending.Offset+chunkSize {
+				return NewDecodeSignaturesError(fmt.Errorf("file size %d does not match %d chunks", fileSize, pending.Index+1))
+			}
+			pending.Length = int(fileSize - pending.Offset)
+			signatures.Add(*pending)
+			return nil
+		default:
+			return NewDecodeSignaturesError(fmt.Errorf("unknown record 0x%02x", tag))
+		}
+	}
+}
+
+// Reads the digest of the original file, which has to be followed by the END record.
+func decodeDigestRecord(reader *bufio.Reader, signatures *differ.SignatureTable) error {
+	digest := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(reader, digest); err != nil {
+		return NewDecodeSignaturesError(NoEOF(err))
+	}
+	if tag, _ := reader.Peek(1); len(tag) > 0 && tag[0] != recordEnd {
+		return NewDecodeSignaturesError(fmt.Errorf("record 0x%02x after the digest", tag[0]))
+	}
+	signatures.Digest = digest
+	return nil
+}
@@ -0,0 +1,238 @@
+package fileio
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Psykepro/rdiff/pkg/differ"
+	"github.com/Psykepro/rdiff/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeSignatures(t *testing.T) {
+	signatures := differ.NewSignatureTable(16, hash.Adler32, hash.SHA256, 2, []differ.Block{
+		{Index: 0, Offset: 0, Length: 16, WeakHash: 0x01020304, StrongHash: []byte{0xaa, 0xbb}},
+		{Index: 1, Offset: 16, Length: 3, WeakHash: 0x05060708, StrongHash: []byte{0xcc, 0xdd}},
+	})
+
+	var buffer bytes.Buffer
+	err := EncodeSignatures(&buffer, signatures)
+	assert.NoError(t, err)
+
+	expected := []byte{
+		'R', 'D', 'S', 'G', // magic
+		1,                  // version
+		byte(hash.Adler32), // weak hash
+		byte(hash.SHA256),  // strong hash
+		2,                  // strong hash length
+		0, 0, 0, 16,        // chunk size
+		0x01, 1, 2, 3, 4, 0xaa, 0xbb,
+		0x01, 5, 6, 7, 8, 0xcc, 0xdd,
+		0x00, 0, 0, 0, 0, 0, 0, 0, 19, // file size
+	}
+	assert.Equal(t, expected, buffer.Bytes())
+
+	decoded, err := DecodeSignatures(&buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, signatures, decoded)
+}
+
+func TestSignatureDigest(t *testing.T) {
+	digest := sha256.Sum256([]byte("original file of 19"))
+	signatures := differ.NewSignatureTable(16, hash.Adler32, hash.SHA256, 2, []differ.Block{
+		{Index: 0, Offset: 0, Length: 16, WeakHash: 0x01020304, StrongHash: []byte{0xaa, 0xbb}},
+		{Index: 1, Offset: 16, Length: 3, WeakHash: 0x05060708, StrongHash: []byte{0xcc, 0xdd}},
+	})
+	signatures.Digest = digest[:]
+
+	var buffer bytes.Buffer
+	assert.NoError(t, EncodeSignatures(&buffer, signatures))
+	encoded := buffer.Bytes()
+
+	end := append(append([]byte{0x04}, digest[:]...), 0x00, 0, 0, 0, 0, 0, 0, 0, 19)
+	assert.Equal(t, end, encoded[len(encoded)-len(end):])
+
+	decoded, err := DecodeSignatures(bytes.NewReader(encoded))
+	assert.NoError(t, err)
+	assert.Equal(t, signatures, decoded)
+
+	invalid := map[string][]byte{
+		"Truncated Digest":     encoded[:len(encoded)-len(end)+10],
+		"Chunk After Digest":   append(append([]byte(nil), encoded[:len(encoded)-9]...), encoded[12:19]...),
+		"Missing End":          encoded[:len(encoded)-9],
+		"Digest Before Chunks": append(append(append([]byte(nil), encoded[:12]...), end[:33]...), encoded[12:]...),
+	}
+	for name, input := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := DecodeSignatures(bytes.NewReader(input))
+			assert.ErrorIs(t, err, ErrDecodeSignatures)
+		})
+	}
+
+	signatures.Digest = digest[:20]
+	assert.ErrorIs(t, EncodeSignatures(io.Discard, signatures), ErrEncodeSignatures)
+}
+
+func TestSignatureWriterStreaming(t *testing.T) {
+	original := strings.Repeat("This is a streamed original file. ", 100)
+	differInstance := differ.New(16)
+
+	var streamed bytes.Buffer
+	writer, err := NewSignatureWriter(&streamed, differInstance.NewSignatureTable())
+	assert.NoError(t, err)
+	assert.NoError(t, differInstance.StreamSignatures(strings.NewReader(original), writer))
+	assert.NoError(t, writer.Close())
+
+	var encoded bytes.Buffer
+	signatures, err := differInstance.GenerateSignatures(strings.NewReader(original))
+	assert.NoError(t, err)
+	assert.NoError(t, EncodeSignatures(&encoded, signatures))
+	assert.Equal(t, encoded.Bytes(), streamed.Bytes())
+
+	decoded, err := DecodeSignatures(&streamed)
+	assert.NoError(t, err)
+	assert.Equal(t, signatures, decoded)
+}
+
+func TestContentDefinedSignatures(t *testing.T) {
+	signatures := differ.NewSignatureTable(16, hash.Buzhash, hash.SHA256, 2, []differ.Block{
+		{Index: 0, Offset: 0, Length: 20, WeakHash: 0x01020304, StrongHash: []byte{0xaa, 0xbb}},
+		{Index: 1, Offset: 20, Length: 5, WeakHash: 0x05060708, StrongHash: []byte{0xcc, 0xdd}},
+	})
+	signatures.MinChunkSize = 4
+	signatures.MaxChunkSize = 64
+
+	var buffer bytes.Buffer
+	assert.NoError(t, EncodeSignatures(&buffer, signatures))
+	encoded := buffer.Bytes()
+
+	expected := []byte{
+		'R', 'D', 'S', 'G', 1, byte(hash.Buzhash), byte(hash.SHA256), 2, 0, 0, 0, 16,
+		0x02, 0, 0, 0, 4, 0, 0, 0, 64, // chunking
+		0x03, 0, 0, 0, 20, 1, 2, 3, 4, 0xaa, 0xbb,
+		0x03, 0, 0, 0, 5, 5, 6, 7, 8, 0xcc, 0xdd,
+		0x00, 0, 0, 0, 0, 0, 0, 0, 25, // file size
+	}
+	assert.Equal(t, expected, encoded)
+
+	decoded, err := DecodeSignatures(bytes.NewReader(encoded))
+	assert.NoError(t, err)
+	assert.Equal(t, signatures, decoded)
+	assert.True(t, decoded.ContentDefined())
+
+	invalid := map[string][]byte{
+		"Wrong File Size":       append(append([]byte(nil), encoded[:len(encoded)-1]...), 24),
+		"Chunk Over Maximum":    append(append(append([]byte(nil), encoded[:22]...), 0, 0, 1, 0), encoded[26:]...),
+		"Maximum Too Large":     append(append(append([]byte(nil), encoded[:17]...), 0x40, 0, 0, 1), encoded[21:]...),
+		"Minimum Over Average":  append(append(append([]byte(nil), encoded[:13]...), 0, 0, 0, 17), encoded[17:]...),
+		"Fixed Chunk Record":    append(append(append([]byte(nil), encoded[:21]...), 0x01), encoded[22:]...),
+		"Missing Sized Chunks":  encoded[:25],
+		"Trailing Sized Chunks": append(append([]byte(nil), encoded...), 0x03),
+	}
+	for name, input := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := DecodeSignatures(bytes.NewReader(input))
+			assert.ErrorIs(t, err, ErrDecodeSignatures)
+		})
+	}
+}
+
+func TestDecodeSignatures(t *testing.T) {
+	signatures := differ.NewSignatureTable(16, hash.Adler32, hash.BLAKE2b, 32, nil)
+	var empty bytes.Buffer
+	assert.NoError(t, EncodeSignatures(&empty, signatures))
+
+	valid := func() []byte {
+		var buffer bytes.Buffer
+		differInstance := differ.New(4)
+		signatures, err := differInstance.GenerateSignatures(bufio.NewReader(strings.NewReader("This is a test")))
+		assert.NoError(t, err)
+		assert.NoError(t, EncodeSignatures(&buffer, signatures))
+		return buffer.Bytes()
+	}
+
+	testCases := []struct {
+		name           string
+		input          []byte
+		expectedChunks int
+		expectedErr    error
+	}{
+		{
+			name:           "Valid Signatures",
+			input:          valid(),
+			expectedChunks: 4,
+		},
+		{
+			name:           "Empty File Signatures",
+			input:          empty.Bytes(),
+			expectedChunks: 0,
+		},
+		{
+			name:        "Empty Input",
+			input:       []byte{},
+			expectedErr: ErrDecodeSignatures,
+		},
+		{
+			name:        "Invalid Magic",
+			input:       append([]byte("GOB!"), valid()[4:]...),
+			expectedErr: ErrDecodeSignatures,
+		},
+		{
+			name:        "Unsupported Version",
+			input:       append(append([]byte("RDSG"), 9), valid()[5:]...),
+			expectedErr: ErrDecodeSignatures,
+		},
+		{
+			name:        "Chunk Size Too Large",
+			input:       append(append(append([]byte(nil), valid()[:8]...), 0x40, 0, 0, 1), valid()[12:]...),
+			expectedErr: ErrDecodeSignatures,
+		},
+		{
+			name:        "Missing Chunks",
+			input:       valid()[:len(valid())-1],
+			expectedErr: ErrDecodeSignatures,
+		},
+		{
+			name:        "Missing End",
+			input:       valid()[:len(valid())-9],
+			expectedErr: ErrDecodeSignatures,
+		},
+		{
+			name:        "File Size Too Long",
+			input:       append(valid()[:len(valid())-1], 17),
+			expectedErr: ErrDecodeSignatures,
+		},
+		{
+			name:        "File Size Too Short",
+			input:       append(valid()[:len(valid())-1], 12),
+			expectedErr: ErrDecodeSignatures,
+		},
+		{
+			name:        "Unknown Record",
+			input:       append(valid()[:12], 0x07),
+			expectedErr: ErrDecodeSignatures,
+		},
+		{
+			name:        "Trailing Data",
+			input:       append(valid(), 0),
+			expectedErr: ErrDecodeSignatures,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			signatures, err := DecodeSignatures(bytes.NewReader(tc.input))
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, signatures)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedChunks, signatures.Len())
+		})
+	}
+}
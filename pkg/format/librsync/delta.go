@@ -0,0 +1,153 @@
+package librsync
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/Psykepro/rdiff/pkg/differ"
+)
+
+/*
+Delta file format of librsync, all integers are big endian:
+
+	magic, 4 bytes, DeltaMagic
+	sequence of commands, each starting with its 1 byte opcode:
+		0x00       END
+		0x01-0x40  LITERAL, the opcode is the number of literals which follow
+		0x41-0x44  LITERAL, followed by the number of literals in 1, 2, 4 or 8 bytes and the literals
+		0x45-0x54  COPY, followed by the offset in the original file and the number of bytes to copy,
+		           each in 1, 2, 4 or 8 bytes. The opcode is 0x45 + 4*offset size index + length size index,
+		           where the size index is 0, 1, 2, 3 for 1, 2, 4, 8 bytes.
+
+Copies address bytes instead of chunks, so applying a delta does not need to know the chunk size.
+*/
+const (
+	opEnd            = 0x00
+	opLiteralMax     = 0x40
+	opLiteralN1      = 0x41
+	opCopyN1N1       = 0x45
+	opCopyN8N8       = 0x54
+	maxImmediateSize = opLiteralMax
+)
+
+// Encodes delta instructions as librsync commands.
+type DeltaWriter struct {
+	writer     *bufio.Writer
+	signatures *differ.SignatureTable
+	buffer     []byte
+}
+
+/*
+Creates a delta writer and writes the magic of the delta. The signatures are needed
+to turn the chunks of copy instructions into byte ranges of the original file.
+*/
+func NewDeltaWriter(w io.Writer, signatures *differ.SignatureTable) (*DeltaWriter, error) {
+	d := &DeltaWriter{writer: bufio.NewWriter(w), signatures: signatures}
+	d.buffer = binary.BigEndian.AppendUint32(d.buffer, DeltaMagic)
+	if err := d.flushBuffer(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *DeltaWriter) WriteOp(op differ.Op) error {
+	switch op.Type {
+	case differ.OpCopyRange:
+		return d.writeCopy(uint64(op.Offset), uint64(op.Length))
+	case differ.OpCopy:
+		if op.Count < 1 || op.BlockIndex < 0 || op.BlockIndex+op.Count > d.signatures.Len() {
+			return fmt.Errorf("%w: copy of chunks %d-%d is out of range", ErrEncodeDelta, op.BlockIndex, op.BlockIndex+op.Count-1)
+		}
+		first := d.signatures.Blocks[op.BlockIndex]
+		last := d.signatures.Blocks[op.BlockIndex+op.Count-1]
+		offset := uint64(first.Offset)
+		return d.writeCopy(offset, uint64(last.Offset+int64(last.Length))-offset)
+	case differ.OpLiteral:
+		if len(op.Data) == 0 {
+			return nil
+		}
+		length := uint64(len(op.Data))
+		if length <= maxImmediateSize {
+			d.buffer = append(d.buffer, byte(length))
+		} else {
+			lengthSize := paramSize(length)
+			d.buffer = append(d.buffer, opLiteralN1+byte(sizeIndex(lengthSize)))
+			d.buffer = appendParam(d.buffer, length, lengthSize)
+		}
+		if err := d.flushBuffer(); err != nil {
+			return err
+		}
+		if _, err := d.writer.Write(op.Data); err != nil {
+			return fmt.Errorf("%w: %w", ErrEncodeDelta, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown instruction %v", ErrEncodeDelta, op.Type)
+	}
+}
+
+// Writes the END command and flushes the delta.
+func (d *DeltaWriter) Close() error {
+	d.buffer = append(d.buffer, opEnd)
+	if err := d.flushBuffer(); err != nil {
+		return err
+	}
+	if err := d.writer.Flush(); err != nil {
+		return fmt.Errorf("%w: %w", ErrEncodeDelta, err)
+	}
+	return nil
+}
+
+// Writes a COPY command with the smallest parameters holding offset and length.
+func (d *DeltaWriter) writeCopy(offset, length uint64) error {
+	offsetSize, lengthSize := paramSize(offset), paramSize(length)
+	d.buffer = append(d.buffer, opCopyN1N1+byte(4*sizeIndex(offsetSize)+sizeIndex(lengthSize)))
+	d.buffer = appendParam(d.buffer, offset, offsetSize)
+	d.buffer = appendParam(d.buffer, length, lengthSize)
+	return d.flushBuffer()
+}
+
+func (d *DeltaWriter) flushBuffer() error {
+	_, err := d.writer.Write(d.buffer)
+	d.buffer = d.buffer[:0]
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrEncodeDelta, err)
+	}
+	return nil
+}
+
+// Smallest of the parameter sizes librsync supports which can hold the value.
+func paramSize(value uint64) int {
+	switch {
+	case value <= 0xff:
+		return 1
+	case value <= 0xffff:
+		return 2
+	case value <= 0xffffffff:
+		return 4
+	default:
+		return 8
+	}
+}
+
+func sizeIndex(size int) int {
+	switch size {
+	case 1:
+		return 0
+	case 2:
+		return 1
+	case 4:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func appendParam(buffer []byte, value uint64, size int) []byte {
+	for shift := 8 * (size - 1); shift >= 0; shift -= 8 {
+		buffer = append(buffer, byte(value>>shift))
+	}
+	return buffer
+}
@@ -0,0 +1,236 @@
+package librsync
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/Psykepro/rdiff/pkg/differ"
+	"github.com/Psykepro/rdiff/pkg/hash"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDataPath = "../../../test/testdata/"
+
+// The golden files were generated ahead of time with a librsync compatible rdiff from original.txt and modified.txt.
+var goldenCases = []struct {
+	name         string
+	signature    string
+	delta        string
+	chunkSize    int
+	strongHash   hash.StrongHash
+	strongLength int
+}{
+	{
+		name:         "BLAKE2",
+		signature:    "librsync-blake2.sig",
+		delta:        "librsync-blake2.delta",
+		chunkSize:    64,
+		strongHash:   hash.BLAKE2b,
+		strongLength: 32,
+	},
+	{
+		name:         "MD4",
+		signature:    "librsync-md4.sig",
+		delta:        "librsync-md4.delta",
+		chunkSize:    128,
+		strongHash:   hash.MD4,
+		strongLength: 8,
+	},
+}
+
+func TestEncodeSignatures(t *testing.T) {
+	original := readTestData(t, "original.txt")
+
+	for _, tc := range goldenCases {
+		t.Run(tc.name, func(t *testing.T) {
+			differInstance := differ.New(tc.chunkSize, differ.WithWeakHash(WeakHash), differ.WithStrongHash(tc.strongHash, tc.strongLength))
+			signatures, err := differInstance.GenerateSignatures(bufio.NewReader(bytes.NewReader(original)))
+			assert.NoError(t, err)
+
+			var buffer bytes.Buffer
+			assert.NoError(t, EncodeSignatures(&buffer, signatures))
+			assert.Equal(t, readTestData(t, tc.signature), buffer.Bytes())
+		})
+	}
+}
+
+func TestEncodeSignaturesUnsupportedHash(t *testing.T) {
+	differInstance := differ.New(16, differ.WithStrongHash(hash.SHA256, 0))
+	signatures, err := differInstance.GenerateSignatures(bufio.NewReader(bytes.NewReader([]byte("This is a test"))))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, EncodeSignatures(&bytes.Buffer{}, signatures), ErrEncodeSignatures)
+
+	differInstance = differ.New(16, differ.WithWeakHash(WeakHash), differ.WithStrongHash(hash.SHA256, 0))
+	signatures, err = differInstance.GenerateSignatures(bufio.NewReader(bytes.NewReader([]byte("This is a test"))))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, EncodeSignatures(&bytes.Buffer{}, signatures), ErrEncodeSignatures)
+}
+
+func TestDecodeSignatures(t *testing.T) {
+	for _, tc := range goldenCases {
+		t.Run(tc.name, func(t *testing.T) {
+			golden := readTestData(t, tc.signature)
+			signatures, err := DecodeSignatures(bytes.NewReader(golden))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.chunkSize, signatures.ChunkSize)
+			assert.Equal(t, WeakHash, signatures.WeakHash)
+			assert.Equal(t, tc.strongHash, signatures.StrongHash)
+			assert.Equal(t, tc.strongLength, signatures.StrongLength)
+
+			var buffer bytes.Buffer
+			assert.NoError(t, EncodeSignatures(&buffer, signatures))
+			assert.Equal(t, golden, buffer.Bytes())
+		})
+	}
+}
+
+func TestDecodeSignaturesInvalid(t *testing.T) {
+	golden := readTestData(t, goldenCases[0].signature)
+
+	testCases := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "Empty Input", input: []byte{}},
+		{name: "Delta Magic", input: append([]byte{0x72, 0x73, 0x02, 0x36}, golden[4:]...)},
+		{name: "Rabin-Karp Magic", input: append([]byte{0x72, 0x73, 0x01, 0x47}, golden[4:]...)},
+		{name: "Strong Hash Too Long", input: append(append([]byte{}, golden[:8]...), 0, 0, 0, 33)},
+		{name: "Truncated Chunk", input: golden[:len(golden)-1]},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			signatures, err := DecodeSignatures(bytes.NewReader(tc.input))
+			assert.ErrorIs(t, err, ErrDecodeSignatures)
+			assert.Nil(t, signatures)
+		})
+	}
+}
+
+func TestPatchGoldenDelta(t *testing.T) {
+	original := readTestData(t, "original.txt")
+	modified := readTestData(t, "modified.txt")
+
+	for _, tc := range goldenCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var patched bytes.Buffer
+			err := Patch(bytes.NewReader(original), bytes.NewReader(readTestData(t, tc.delta)), &patched)
+			assert.NoError(t, err)
+			assert.Equal(t, modified, patched.Bytes())
+		})
+	}
+}
+
+func TestDeltaFromGoldenSignatures(t *testing.T) {
+	original := readTestData(t, "original.txt")
+	modified := readTestData(t, "modified.txt")
+
+	for _, tc := range goldenCases {
+		t.Run(tc.name, func(t *testing.T) {
+			signatures, err := DecodeSignatures(bytes.NewReader(readTestData(t, tc.signature)))
+			assert.NoError(t, err)
+
+			differInstance := differ.New(signatures.ChunkSize)
+			var encoded bytes.Buffer
+			writer, err := NewDeltaWriter(&encoded, signatures)
+			assert.NoError(t, err)
+			assert.NoError(t, differInstance.GenerateDelta(context.Background(), signatures, bytes.NewReader(modified), writer))
+			assert.NoError(t, writer.Close())
+
+			var patched bytes.Buffer
+			assert.NoError(t, Patch(bytes.NewReader(original), &encoded, &patched))
+			assert.Equal(t, modified, patched.Bytes())
+		})
+	}
+}
+
+func TestDeltaWriter(t *testing.T) {
+	signatures := differ.NewSignatureTable(300, WeakHash, hash.BLAKE2b, 32, []differ.Block{
+		{Index: 0, Offset: 0, Length: 300},
+		{Index: 1, Offset: 300, Length: 300},
+		{Index: 2, Offset: 600, Length: 10},
+	})
+	longLiterals := bytes.Repeat([]byte("a"), 65)
+
+	var buffer bytes.Buffer
+	writer, err := NewDeltaWriter(&buffer, signatures)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.WriteOp(differ.Literal([]byte("abc"))))
+	assert.NoError(t, writer.WriteOp(differ.Copy(0, 1)))
+	assert.NoError(t, writer.WriteOp(differ.Literal(longLiterals)))
+	assert.NoError(t, writer.WriteOp(differ.Copy(1, 2)))
+	assert.NoError(t, writer.WriteOp(differ.CopyRange(300, 5)))
+	assert.ErrorIs(t, writer.WriteOp(differ.Copy(2, 2)), ErrEncodeDelta)
+	assert.NoError(t, writer.Close())
+
+	expected := []byte{0x72, 0x73, 0x02, 0x36}
+	expected = append(expected, 0x03, 'a', 'b', 'c')
+	expected = append(expected, 0x46, 0x00, 0x01, 0x2c) // COPY_N1_N2 offset 0, length 300
+	expected = append(expected, 0x41, 65)               // LITERAL_N1 length 65
+	expected = append(expected, longLiterals...)
+	expected = append(expected, 0x4a, 0x01, 0x2c, 0x01, 0x36) // COPY_N2_N2 offset 300, length 310
+	expected = append(expected, 0x49, 0x01, 0x2c, 0x05)       // COPY_N2_N1 offset 300, length 5
+	expected = append(expected, 0x00)
+	assert.Equal(t, expected, buffer.Bytes())
+}
+
+func TestPatchInvalid(t *testing.T) {
+	original := []byte("original file")
+
+	testCases := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "Empty Input", input: []byte{}},
+		{name: "Signature Magic", input: []byte{0x72, 0x73, 0x01, 0x37, 0x00}},
+		{name: "Missing End", input: []byte{0x72, 0x73, 0x02, 0x36, 0x01, 'a'}},
+		{name: "Truncated Literal", input: []byte{0x72, 0x73, 0x02, 0x36, 0x03, 'a'}},
+		{name: "Reserved Opcode", input: []byte{0x72, 0x73, 0x02, 0x36, 0x55, 0x00}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Patch(bytes.NewReader(original), bytes.NewReader(tc.input), &bytes.Buffer{})
+			assert.ErrorIs(t, err, ErrDecodeDelta)
+		})
+	}
+}
+
+func TestPatchOriginalErrors(t *testing.T) {
+	copyPastEnd := []byte{0x72, 0x73, 0x02, 0x36, 0x45, 0x05, 0x20, 0x00}
+	err := Patch(bytes.NewReader([]byte("original file")), bytes.NewReader(copyPastEnd), &bytes.Buffer{})
+	assert.ErrorIs(t, err, differ.ErrReadOriginal)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	errRead := errors.New("read failed")
+	err = Patch(failingReaderAt{errRead}, bytes.NewReader(copyPastEnd), &bytes.Buffer{})
+	assert.ErrorIs(t, err, differ.ErrReadOriginal)
+	assert.ErrorIs(t, err, errRead)
+
+	// The cause of a truncated file is kept along with the sentinel
+	_, err = DecodeSignatures(bytes.NewReader([]byte{0x72, 0x73}))
+	assert.ErrorIs(t, err, ErrDecodeSignatures)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	err = Patch(bytes.NewReader(nil), bytes.NewReader([]byte{0x72, 0x73, 0x02, 0x36, 0x03, 'a'}), &bytes.Buffer{})
+	assert.ErrorIs(t, err, ErrDecodeDelta)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+type failingReaderAt struct {
+	err error
+}
+
+func (r failingReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	return 0, r.err
+}
+
+func readTestData(t *testing.T, name string) []byte {
+	data, err := os.ReadFile(testDataPath + name)
+	assert.NoError(t, err)
+	return data
+}
@@ -0,0 +1,84 @@
+package librsync
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/Psykepro/rdiff/pkg/differ"
+	"github.com/Psykepro/rdiff/pkg/fileio"
+)
+
+// Patch rebuilds the updated file by executing the commands of a librsync delta against the original file.
+func Patch(original io.ReaderAt, delta io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(delta)
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return fmt.Errorf("%w: %w", ErrDecodeDelta, err)
+	}
+	if value := binary.BigEndian.Uint32(magic); value != DeltaMagic {
+		return fmt.Errorf("%w: unsupported magic 0x%08x", ErrDecodeDelta, value)
+	}
+
+	for {
+		opcode, err := reader.ReadByte()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrDecodeDelta, fileio.NoEOF(err))
+		}
+
+		switch {
+		case opcode == opEnd:
+			return nil
+		case opcode <= opLiteralMax:
+			if _, err := io.CopyN(out, reader, int64(opcode)); err != nil {
+				return fmt.Errorf("%w: %w", ErrDecodeDelta, fileio.NoEOF(err))
+			}
+		case opcode < opCopyN1N1:
+			length, err := readParam(reader, 1<<(opcode-opLiteralN1))
+			if err != nil {
+				return err
+			}
+			if _, err := io.CopyN(out, reader, length); err != nil {
+				return fmt.Errorf("%w: %w", ErrDecodeDelta, fileio.NoEOF(err))
+			}
+		case opcode <= opCopyN8N8:
+			offset, err := readParam(reader, 1<<((opcode-opCopyN1N1)/4))
+			if err != nil {
+				return err
+			}
+			length, err := readParam(reader, 1<<((opcode-opCopyN1N1)%4))
+			if err != nil {
+				return err
+			}
+			copied, err := io.Copy(out, differ.NewOriginalReader(original, offset, length))
+			if err != nil {
+				return err
+			}
+			// The delta was generated against a longer original file, or the original file was truncated
+			if copied != length {
+				return differ.NewReadOriginalError(fmt.Errorf("copy of %d bytes at offset %d is past the end of the original file: %w", length, offset, io.ErrUnexpectedEOF))
+			}
+		default:
+			return fmt.Errorf("%w: unknown opcode 0x%02x", ErrDecodeDelta, opcode)
+		}
+	}
+}
+
+// Reads a big endian parameter of 1, 2, 4 or 8 bytes.
+func readParam(reader io.Reader, size int) (int64, error) {
+	param := make([]byte, size)
+	if _, err := io.ReadFull(reader, param); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDecodeDelta, fileio.NoEOF(err))
+	}
+	var value uint64
+	for _, b := range param {
+		value = value<<8 | uint64(b)
+	}
+	if value > math.MaxInt64 {
+		return 0, fmt.Errorf("%w: parameter %d is out of range", ErrDecodeDelta, value)
+	}
+	return int64(value), nil
+}
@@ -0,0 +1,168 @@
+/*
+Package librsync reads and writes the signature and delta formats of librsync, so that files
+produced by its rdiff command can be used by this rdiff and the other way around.
+*/
+package librsync
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/Psykepro/rdiff/pkg/differ"
+	"github.com/Psykepro/rdiff/pkg/hash"
+)
+
+// Magic numbers librsync starts its files with.
+const (
+	DeltaMagic = 0x72730236
+	// Signature using the rollsum and MD4
+	MD4SigMagic = 0x72730136
+	// Signature using the rollsum and BLAKE2b
+	BLAKE2SigMagic = 0x72730137
+)
+
+const (
+	WeakHash          = hash.Rollsum
+	DefaultStrongHash = hash.BLAKE2b
+)
+
+var (
+	ErrEncodeSignatures = fmt.Errorf("error in encoding librsync signatures")
+	ErrDecodeSignatures = fmt.Errorf("error in decoding librsync signatures")
+	ErrEncodeDelta      = fmt.Errorf("error in encoding librsync delta")
+	ErrDecodeDelta      = fmt.Errorf("error in decoding librsync delta")
+)
+
+/*
+Signature file format of librsync, all integers are big endian:
+
+	magic, 4 bytes, MD4SigMagic or BLAKE2SigMagic
+	chunk size, 4 bytes
+	strong hash length, 4 bytes
+	one record per chunk, the 4 byte rollsum followed by the truncated strong hash
+
+Unlike the native format it does not store the length of the original file.
+SignatureWriter encodes it chunk by chunk.
+*/
+type SignatureWriter struct {
+	writer *bufio.Writer
+	record []byte
+}
+
+// Creates a signature writer for the chunk size and hashes of signatures and writes the header. The blocks of signatures are not written.
+func NewSignatureWriter(w io.Writer, signatures *differ.SignatureTable) (*SignatureWriter, error) {
+	if signatures.WeakHash != WeakHash {
+		return nil, fmt.Errorf("%w: weak hash %v is not supported", ErrEncodeSignatures, signatures.WeakHash)
+	}
+	if signatures.ContentDefined() {
+		return nil, fmt.Errorf("%w: content-defined chunks are not supported", ErrEncodeSignatures)
+	}
+	var magic uint32
+	switch signatures.StrongHash {
+	case hash.MD4:
+		magic = MD4SigMagic
+	case hash.BLAKE2b:
+		magic = BLAKE2SigMagic
+	default:
+		return nil, fmt.Errorf("%w: strong hash %v is not supported", ErrEncodeSignatures, signatures.StrongHash)
+	}
+
+	s := &SignatureWriter{
+		writer: bufio.NewWriter(w),
+		record: make([]byte, 4+signatures.StrongLength),
+	}
+	header := make([]byte, 12)
+	binary.BigEndian.PutUint32(header, magic)
+	binary.BigEndian.PutUint32(header[4:], uint32(signatures.ChunkSize))
+	binary.BigEndian.PutUint32(header[8:], uint32(signatures.StrongLength))
+	if _, err := s.writer.Write(header); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncodeSignatures, err)
+	}
+	return s, nil
+}
+
+func (s *SignatureWriter) WriteBlock(block differ.Block) error {
+	if len(block.StrongHash) != len(s.record)-4 {
+		return fmt.Errorf("%w: strong hash of chunk %d is %d bytes long instead of %d", ErrEncodeSignatures, block.Index, len(block.StrongHash), len(s.record)-4)
+	}
+	binary.BigEndian.PutUint32(s.record, block.WeakHash)
+	copy(s.record[4:], block.StrongHash)
+	if _, err := s.writer.Write(s.record); err != nil {
+		return fmt.Errorf("%w: %w", ErrEncodeSignatures, err)
+	}
+	return nil
+}
+
+// Flushes the signatures. librsync signatures have no trailer, they end with the last chunk.
+func (s *SignatureWriter) Close() error {
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("%w: %w", ErrEncodeSignatures, err)
+	}
+	return nil
+}
+
+func EncodeSignatures(w io.Writer, signatures *differ.SignatureTable) error {
+	writer, err := NewSignatureWriter(w, signatures)
+	if err != nil {
+		return err
+	}
+	for _, block := range signatures.Blocks {
+		if err := writer.WriteBlock(block); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+/*
+Decodes librsync signatures. Since the length of the original file is unknown, every chunk is assumed
+to be full sized, which only means the last chunk is never matched when it is shorter than the others.
+*/
+func DecodeSignatures(r io.Reader) (*differ.SignatureTable, error) {
+	reader := bufio.NewReader(r)
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecodeSignatures, err)
+	}
+
+	var strongHash hash.StrongHash
+	switch magic := binary.BigEndian.Uint32(header); magic {
+	case MD4SigMagic:
+		strongHash = hash.MD4
+	case BLAKE2SigMagic:
+		strongHash = hash.BLAKE2b
+	default:
+		return nil, fmt.Errorf("%w: unsupported magic 0x%08x", ErrDecodeSignatures, magic)
+	}
+	chunkSize := binary.BigEndian.Uint32(header[4:])
+	strongLength := binary.BigEndian.Uint32(header[8:])
+	if chunkSize < 1 || chunkSize > 1<<30 {
+		return nil, fmt.Errorf("%w: invalid chunk size %d", ErrDecodeSignatures, chunkSize)
+	}
+	if strongLength < 1 || strongLength > uint32(strongHash.Size()) {
+		return nil, fmt.Errorf("%w: invalid strong hash length %d", ErrDecodeSignatures, strongLength)
+	}
+
+	signatures := differ.NewSignatureTable(int(chunkSize), WeakHash, strongHash, int(strongLength), nil)
+	record := make([]byte, 4+strongLength)
+	for {
+		_, err := io.ReadFull(reader, record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDecodeSignatures, err)
+		}
+		signatures.Add(differ.Block{
+			Index:      signatures.Len(),
+			Offset:     int64(signatures.Len()) * int64(chunkSize),
+			Length:     int(chunkSize),
+			WeakHash:   binary.BigEndian.Uint32(record),
+			StrongHash: append([]byte(nil), record[4:]...),
+		})
+	}
+	return signatures, nil
+}
@@ -1,70 +1,88 @@
 package hash
 
-import (
-	"reflect"
-)
-
 // This constant is used as a modulo value when calculating Adler32 hash.
 const ADLER_CONSTANT = 65521
 
+// Largest number of bytes added to the sums before they have to be reduced, so that they never overflow.
+const adlerWriteBlock = 1 << 20
+
 type adler32 struct {
-	s1     uint
-	s2     uint
-	window []byte
+	s1        uint
+	s2        uint
+	lengthMod uint //Length of the window modulo ADLER_CONSTANT
+	window    ring
 }
 
-func NewAdler32(chunkSize int) *adler32 {
+func NewAdler32(windowSize int) Rolling {
 	return &adler32{
 		s1:     1,
 		s2:     0,
-		window: make([]byte, 0, chunkSize),
+		window: newRing(windowSize),
 	}
 }
 
-func (ad *adler32) WindowLength() int {
-	return len(ad.window)
-}
-
-// Writes chunk byte slice to the window byte slice.
-func (ad *adler32) Write(chunk []byte) {
-	ad.window = chunk
-}
-
-func (ad *adler32) Hash() uint {
-	for _, val := range ad.window {
-		ad.s1 += uint(val)
-		ad.s2 += ad.s1
+// Appends data to the window and adds it to the sums.
+func (ad *adler32) Write(data []byte) {
+	for len(data) > 0 {
+		block := data[:min(len(data), adlerWriteBlock)]
+		data = data[len(block):]
+		for _, val := range block {
+			ad.window.push(val)
+			ad.s1 += uint(val)
+			ad.s2 += ad.s1
+		}
+		ad.s1 = ad.s1 % ADLER_CONSTANT
+		ad.s2 = ad.s2 % ADLER_CONSTANT
 	}
-	ad.s1 = ad.s1 % ADLER_CONSTANT
-	ad.s2 = ad.s2 % ADLER_CONSTANT
-	return ad.s2<<16 + ad.s1
+	ad.lengthMod = uint(ad.window.length) % ADLER_CONSTANT
 }
 
-// Appends a single byte c to the window byte slice. Calculates and returns the updated Adler hash.
-func (ad *adler32) RollIn(c byte) uint {
-	ad.window = append(ad.window, c)
+// Appends a single byte c to the window and updates the Adler hash.
+func (ad *adler32) RollIn(c byte) {
+	ad.window.push(c)
 	ad.s1 = (ad.s1 + uint(c)) % ADLER_CONSTANT
 	ad.s2 = (ad.s2 + ad.s1) % ADLER_CONSTANT
-	return ad.s2<<16 + ad.s1
+	ad.lengthMod = uint(ad.window.length) % ADLER_CONSTANT
 }
 
-// Removes the first item from the window byte slice. Calculates and returns the updated Adler hash and the removed byte.
-func (ad *adler32) RollOut() (uint, byte) {
-	removed := ad.window[0]
-	//Adding Adler constant so that ad.s1 does not overflow during subtraction since it is an unsigned subtraction
+// Removes the first byte of the window. Updates the Adler hash and returns the removed byte.
+func (ad *adler32) RollOut() byte {
+	removed := ad.window.pop()
 	ad.s1 = (ad.s1 + ADLER_CONSTANT - uint(removed)) % ADLER_CONSTANT
-	//Adding Adler constant as many times to make ad.s2 subtraction result positive in order to prevent overflow
-	ad.s2 = (ad.s2 + (1+uint(len(ad.window))*uint(removed)/ADLER_CONSTANT)*ADLER_CONSTANT - (uint(len(ad.window)) * uint(removed)) - 1) % ADLER_CONSTANT
-	ad.window = ad.window[1:]
-	return ad.s2<<16 + ad.s1, removed
+	ad.s2 = (ad.s2 + ADLER_CONSTANT*256 - ad.lengthMod*uint(removed) - 1) % ADLER_CONSTANT
+	ad.lengthMod = uint(ad.window.length) % ADLER_CONSTANT
+	return removed
+}
+
+/*
+Removes out from the start of the window and appends in to its end in a single step. The length of the window does
+not change, so nothing is allocated and only s2 needs a modulo, s1 stays below twice ADLER_CONSTANT and is reduced
+by subtraction. ADLER_CONSTANT * 256 is larger than the contribution of out to s2, so s2 never underflows either.
+*/
+func (ad *adler32) Roll(out, in byte) {
+	ad.window.roll(in)
+	s1 := ad.s1 + uint(in) + ADLER_CONSTANT - uint(out)
+	if s1 >= ADLER_CONSTANT {
+		s1 -= ADLER_CONSTANT
+	}
+	if s1 >= ADLER_CONSTANT {
+		s1 -= ADLER_CONSTANT
+	}
+	ad.s1 = s1
+	ad.s2 = (ad.s2 + s1 + ADLER_CONSTANT*256 - ad.lengthMod*uint(out) - 1) % ADLER_CONSTANT
+}
+
+func (ad *adler32) Sum32() uint32 {
+	return uint32(ad.s2<<16 + ad.s1)
 }
 
-func (ad *adler32) GetWindowLiterals() []byte {
-	return ad.window
+func (ad *adler32) Window() []byte {
+	return ad.window.bytes()
 }
 
 func (ad *adler32) Reset() {
-	p := reflect.ValueOf(ad).Elem()
-	p.Set(reflect.Zero(p.Type()))
 	ad.s1 = 1
+	ad.s2 = 0
+	ad.lengthMod = 0
+	ad.window.reset()
 }
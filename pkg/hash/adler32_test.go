@@ -1,6 +1,8 @@
 package hash
 
 import (
+	"fmt"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,7 +12,7 @@ func TestAdler32(t *testing.T) {
 	testCases := []struct {
 		name         string
 		input        string
-		expectedHash uint
+		expectedHash uint32
 	}{
 		{
 			name:         "Test Hash",
@@ -27,6 +29,11 @@ func TestAdler32(t *testing.T) {
 			input:        "aThis is a test",
 			expectedHash: 611517686,
 		},
+		{
+			name:         "Test Roll",
+			input:        "aThis is a tes",
+			expectedHash: 611517686,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -35,37 +42,82 @@ func TestAdler32(t *testing.T) {
 			switch tc.name {
 			case "Test Hash":
 				adler32.Write([]byte(tc.input))
-				hash := adler32.Hash()
-				assert.Equal(t, tc.expectedHash, hash)
+				assert.Equal(t, tc.expectedHash, adler32.Sum32())
 			case "Test RollIn":
-				stringBytes := []byte(tc.input)
-				var hash uint
-				for len(stringBytes) > 0 {
-					hash = adler32.RollIn(stringBytes[0])
-					stringBytes = stringBytes[1:]
+				for _, c := range []byte(tc.input) {
+					adler32.RollIn(c)
 				}
-				assert.Equal(t, tc.expectedHash, hash)
+				assert.Equal(t, tc.expectedHash, adler32.Sum32())
 			case "Test RollOut":
-				stringBytes := []byte(tc.input)
-				var hash uint
-				adler32.Write(stringBytes)
-				adler32.Hash()
-				hash, removed := adler32.RollOut()
-				assert.Equal(t, hash, tc.expectedHash)
-				assert.Equal(t, uint8([]byte("a")[0]), removed)
+				adler32.Write([]byte(tc.input))
+				removed := adler32.RollOut()
+				assert.Equal(t, tc.expectedHash, adler32.Sum32())
+				assert.Equal(t, byte('a'), removed)
+			case "Test Roll":
+				adler32.Write([]byte(tc.input))
+				adler32.Roll('a', 't')
+				assert.Equal(t, tc.expectedHash, adler32.Sum32())
+				assert.Equal(t, []byte("This is a test"), adler32.Window())
 			}
 		})
 	}
 }
 
-func TestGetWindowLiterals(t *testing.T) {
+func TestWindow(t *testing.T) {
 	adler32 := NewAdler32(4)
 	adler32.Write([]byte("Test"))
-	assert.Equal(t, []byte("Test"), adler32.GetWindowLiterals())
+	assert.Equal(t, []byte("Test"), adler32.Window())
 }
 
-func TestGetWindowLength(t *testing.T) {
+func TestWindowLength(t *testing.T) {
 	adler32 := NewAdler32(4)
 	adler32.RollIn([]byte("A")[0])
-	assert.Equal(t, 1, adler32.WindowLength())
+	assert.Equal(t, 1, len(adler32.Window()))
+}
+
+func TestAdler32Reset(t *testing.T) {
+	adler32 := NewAdler32(4)
+	adler32.Write([]byte("Test"))
+	adler32.Reset()
+	assert.Empty(t, adler32.Window())
+
+	adler32.Write([]byte("This is a test"))
+	assert.Equal(t, uint32(611517686), adler32.Sum32())
+}
+
+/*
+Throughput of sliding a window of 16 bytes (the default chunk size) and of 2 KiB over 1 MiB of data, in MB/s.
+The RollIn+RollOut benchmarks slide the window in two steps, the way the delta used to before Roll existed.
+*/
+func BenchmarkAdler32(b *testing.B) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, windowSize := range []int{16, 2048} {
+		b.Run(fmt.Sprintf("RollIn+RollOut/window=%d", windowSize), func(b *testing.B) {
+			adler32 := NewAdler32(windowSize)
+			b.SetBytes(int64(len(data) - windowSize))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				adler32.Reset()
+				adler32.Write(data[:windowSize])
+				for _, c := range data[windowSize:] {
+					adler32.RollIn(c)
+					adler32.RollOut()
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("Roll/window=%d", windowSize), func(b *testing.B) {
+			adler32 := NewAdler32(windowSize)
+			b.SetBytes(int64(len(data) - windowSize))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				adler32.Reset()
+				adler32.Write(data[:windowSize])
+				for j, c := range data[windowSize:] {
+					adler32.Roll(data[j], c)
+				}
+			}
+		})
+	}
 }
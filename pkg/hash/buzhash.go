@@ -0,0 +1,76 @@
+package hash
+
+import "math/bits"
+
+/*
+Random value of every byte used by Buzhash. The table is part of the signature format, since the weak hashes
+stored in a signature file are only comparable with ones computed from the same table, so it is generated
+from a fixed seed with splitmix64 and must never change.
+*/
+var buzhashTable = func() [256]uint32 {
+	var table [256]uint32
+	state := uint64(0x5244494646)
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = uint32(z ^ (z >> 31))
+	}
+	return table
+}()
+
+/*
+Cyclic polynomial rolling hash, also known as Buzhash. The window c0 c1 ... cn-1 hashes to
+rotl(T[c0], n-1) ^ rotl(T[c1], n-2) ^ ... ^ T[cn-1], where T is buzhashTable.
+Every byte is spread over all 32 bits by the table, so even short windows use the whole hash.
+*/
+type buzhash struct {
+	sum    uint32
+	window ring
+}
+
+func NewBuzhash(windowSize int) Rolling {
+	return &buzhash{
+		window: newRing(windowSize),
+	}
+}
+
+// Appends data to the window and adds it to the hash.
+func (b *buzhash) Write(data []byte) {
+	for _, c := range data {
+		b.RollIn(c)
+	}
+}
+
+// Appends a single byte c to the window and updates the hash.
+func (b *buzhash) RollIn(c byte) {
+	b.window.push(c)
+	b.sum = bits.RotateLeft32(b.sum, 1) ^ buzhashTable[c]
+}
+
+// Removes the first byte of the window. Updates the hash and returns the removed byte.
+func (b *buzhash) RollOut() byte {
+	b.sum ^= bits.RotateLeft32(buzhashTable[b.window.bytes()[0]], b.window.length-1)
+	removed := b.window.pop()
+	return removed
+}
+
+// Removes out from the start of the window and appends in to its end.
+func (b *buzhash) Roll(out, in byte) {
+	b.sum = bits.RotateLeft32(b.sum, 1) ^ bits.RotateLeft32(buzhashTable[out], b.window.length) ^ buzhashTable[in]
+	b.window.roll(in)
+}
+
+func (b *buzhash) Sum32() uint32 {
+	return b.sum
+}
+
+func (b *buzhash) Window() []byte {
+	return b.window.bytes()
+}
+
+func (b *buzhash) Reset() {
+	b.sum = 0
+	b.window.reset()
+}
@@ -0,0 +1,74 @@
+package hash
+
+// Base of the Rabin-Karp polynomial. It is odd, so it has an inverse modulo 2^32.
+const RABIN_KARP_BASE = 0x01000193
+
+// Inverse of RABIN_KARP_BASE modulo 2^32, used to remove the first byte of a window of any length.
+var rabinKarpInverse = func() uint32 {
+	// Newton's iteration doubles the number of correct low bits on every step, and an odd number is its own inverse modulo 8
+	inverse := uint32(RABIN_KARP_BASE)
+	for i := 0; i < 4; i++ {
+		inverse *= 2 - RABIN_KARP_BASE*inverse
+	}
+	return inverse
+}()
+
+/*
+Polynomial rolling hash of Rabin and Karp. The window c0 c1 ... cn-1 hashes to
+c0*B^(n-1) + c1*B^(n-2) + ... + cn-1 modulo 2^32, where B is RABIN_KARP_BASE,
+so the modulo comes for free with the overflow of the 32 bit arithmetic.
+*/
+type rabinKarp struct {
+	sum    uint32
+	power  uint32 //B^n where n is the length of the window
+	window ring
+}
+
+func NewRabinKarp(windowSize int) Rolling {
+	return &rabinKarp{
+		power:  1,
+		window: newRing(windowSize),
+	}
+}
+
+// Appends data to the window and adds it to the hash.
+func (r *rabinKarp) Write(data []byte) {
+	for _, c := range data {
+		r.RollIn(c)
+	}
+}
+
+// Appends a single byte c to the window and updates the hash.
+func (r *rabinKarp) RollIn(c byte) {
+	r.window.push(c)
+	r.sum = r.sum*RABIN_KARP_BASE + uint32(c)
+	r.power *= RABIN_KARP_BASE
+}
+
+// Removes the first byte of the window. Updates the hash and returns the removed byte.
+func (r *rabinKarp) RollOut() byte {
+	removed := r.window.pop()
+	r.power *= rabinKarpInverse
+	r.sum -= uint32(removed) * r.power
+	return removed
+}
+
+// Removes out from the start of the window and appends in to its end. The length of the window stays the same, so does the power.
+func (r *rabinKarp) Roll(out, in byte) {
+	r.sum = r.sum*RABIN_KARP_BASE + uint32(in) - uint32(out)*r.power
+	r.window.roll(in)
+}
+
+func (r *rabinKarp) Sum32() uint32 {
+	return r.sum
+}
+
+func (r *rabinKarp) Window() []byte {
+	return r.window.bytes()
+}
+
+func (r *rabinKarp) Reset() {
+	r.sum = 0
+	r.power = 1
+	r.window.reset()
+}
@@ -0,0 +1,22 @@
+package hash
+
+/*
+Rolling checksum over a window of bytes. Bytes enter the window at its end and leave it at its start,
+and the checksum is updated for each of them without going over the whole window again.
+*/
+type Rolling interface {
+	// Appends data to the end of the window.
+	Write(data []byte)
+	// Appends a single byte to the end of the window.
+	RollIn(in byte)
+	// Removes the first byte of the window and returns it.
+	RollOut() byte
+	// Slides the window by one byte. out is the first byte of the window, which leaves it while in enters it.
+	Roll(out, in byte)
+	// Checksum of the bytes in the window.
+	Sum32() uint32
+	// Empties the window.
+	Reset()
+	// Bytes in the window, oldest first. The slice is only valid until the window changes.
+	Window() []byte
+}
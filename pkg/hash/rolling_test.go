@@ -0,0 +1,100 @@
+package hash
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var weakHashes = []WeakHash{Adler32, Rollsum, RabinKarp, Buzhash}
+
+// Hashes data from scratch, which every rolling step has to agree with.
+func recompute(weakHash WeakHash, data []byte) uint32 {
+	rolling := weakHash.New(len(data))
+	rolling.Write(data)
+	return rolling.Sum32()
+}
+
+func TestRollingEqualsRecomputing(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	data := make([]byte, 4096)
+	random.Read(data)
+	// Long runs of the same byte are the worst case of the sums
+	for i := 1024; i < 2048; i++ {
+		data[i] = 0xff
+	}
+	for i := 2048; i < 3072; i++ {
+		data[i] = 0
+	}
+
+	for _, weakHash := range weakHashes {
+		for _, windowSize := range []int{1, 2, 16, 31, 32, 33, 700} {
+			t.Run(fmt.Sprintf("%v/window=%d", weakHash, windowSize), func(t *testing.T) {
+				roll := weakHash.New(windowSize)
+				rollInOut := weakHash.New(windowSize)
+				roll.Write(data[:windowSize])
+				rollInOut.Write(data[:windowSize])
+				for start := 1; start+windowSize <= len(data); start++ {
+					out, in := data[start-1], data[start+windowSize-1]
+					roll.Roll(out, in)
+					rollInOut.RollIn(in)
+					assert.Equal(t, out, rollInOut.RollOut())
+
+					window := data[start : start+windowSize]
+					expected := recompute(weakHash, window)
+					if !assert.Equal(t, expected, roll.Sum32(), "Roll at offset %d, window %d", start, windowSize) ||
+						!assert.Equal(t, expected, rollInOut.Sum32(), "RollIn and RollOut at offset %d, window %d", start, windowSize) {
+						return
+					}
+					assert.Equal(t, window, roll.Window())
+				}
+			})
+		}
+	}
+}
+
+func TestRollingShrinkingWindow(t *testing.T) {
+	data := []byte("This is a test of a shrinking window")
+	for _, weakHash := range weakHashes {
+		t.Run(weakHash.String(), func(t *testing.T) {
+			rolling := weakHash.New(len(data))
+			rolling.Write(data)
+			for start := 1; start < len(data); start++ {
+				assert.Equal(t, data[start-1], rolling.RollOut())
+				assert.Equal(t, recompute(weakHash, data[start:]), rolling.Sum32())
+			}
+		})
+	}
+}
+
+func TestRollingReset(t *testing.T) {
+	for _, weakHash := range weakHashes {
+		t.Run(weakHash.String(), func(t *testing.T) {
+			rolling := weakHash.New(4)
+			rolling.Write([]byte("Test"))
+			rolling.Reset()
+			assert.Empty(t, rolling.Window())
+			rolling.Write([]byte("This is a test"))
+			assert.Equal(t, recompute(weakHash, []byte("This is a test")), rolling.Sum32())
+		})
+	}
+}
+
+func TestRollDoesNotAllocate(t *testing.T) {
+	data := []byte("This is a test of a window sliding without allocating")
+	for _, weakHash := range weakHashes {
+		t.Run(weakHash.String(), func(t *testing.T) {
+			rolling := weakHash.New(16)
+			rolling.Write(data[:16])
+			i := 16
+			allocations := testing.AllocsPerRun(100, func() {
+				rolling.Roll(rolling.Window()[0], data[i%len(data)])
+				i++
+			})
+			assert.Zero(t, allocations)
+			assert.Len(t, rolling.Window(), 16)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package hash
+
+// Added to every byte by the rollsum of rsync and librsync, so that runs of zero bytes still change the sums.
+const ROLLSUM_CHAR_OFFSET = 31
+
+/*
+Rolling checksum of rsync and librsync. It is computed like Adler-32 but the sums are kept
+modulo 2^16 instead of modulo ADLER_CONSTANT and every byte is offset by ROLLSUM_CHAR_OFFSET.
+*/
+type rollsum struct {
+	s1     uint16
+	s2     uint16
+	window ring
+}
+
+func NewRollsum(windowSize int) Rolling {
+	return &rollsum{
+		window: newRing(windowSize),
+	}
+}
+
+// Appends data to the window and adds it to the sums.
+func (r *rollsum) Write(data []byte) {
+	for _, val := range data {
+		r.window.push(val)
+		r.s1 += uint16(val) + ROLLSUM_CHAR_OFFSET
+		r.s2 += r.s1
+	}
+}
+
+// Appends a single byte c to the window and updates the rollsum.
+func (r *rollsum) RollIn(c byte) {
+	r.window.push(c)
+	r.s1 += uint16(c) + ROLLSUM_CHAR_OFFSET
+	r.s2 += r.s1
+}
+
+// Removes the first byte of the window. Updates the rollsum and returns the removed byte.
+func (r *rollsum) RollOut() byte {
+	//The sums wrap around on overflow, so the subtractions need no correction
+	length := uint16(r.window.length)
+	removed := r.window.pop()
+	r.s1 -= uint16(removed) + ROLLSUM_CHAR_OFFSET
+	r.s2 -= length * (uint16(removed) + ROLLSUM_CHAR_OFFSET)
+	return removed
+}
+
+// Removes out from the start of the window and appends in to its end, in a single step like RollsumRotate of librsync.
+func (r *rollsum) Roll(out, in byte) {
+	r.s1 += uint16(in) - uint16(out)
+	r.s2 += r.s1 - uint16(r.window.length)*(uint16(out)+ROLLSUM_CHAR_OFFSET)
+	r.window.roll(in)
+}
+
+func (r *rollsum) Sum32() uint32 {
+	return uint32(r.s2)<<16 | uint32(r.s1)
+}
+
+func (r *rollsum) Window() []byte {
+	return r.window.bytes()
+}
+
+func (r *rollsum) Reset() {
+	r.s1 = 0
+	r.s2 = 0
+	r.window.reset()
+}
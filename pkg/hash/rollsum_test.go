@@ -0,0 +1,55 @@
+package hash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The expected hashes were computed with the rollsum of librsync.
+func TestRollsum(t *testing.T) {
+	t.Run("Test Hash", func(t *testing.T) {
+		rollsum := NewRollsum(14)
+		rollsum.Write([]byte("This is a test"))
+		assert.Equal(t, uint32(823920295), rollsum.Sum32())
+	})
+
+	t.Run("Test RollIn", func(t *testing.T) {
+		rollsum := NewRollsum(14)
+		for _, c := range []byte("This is a test") {
+			rollsum.RollIn(c)
+		}
+		assert.Equal(t, uint32(823920295), rollsum.Sum32())
+	})
+
+	t.Run("Test RollOut", func(t *testing.T) {
+		rollsum := NewRollsum(14)
+		for _, c := range []byte("This is a test!") {
+			rollsum.RollIn(c)
+		}
+		removed := rollsum.RollOut()
+		assert.Equal(t, uint32(826672756), rollsum.Sum32())
+		assert.Equal(t, byte('T'), removed)
+		assert.Equal(t, []byte("his is a test!"), rollsum.Window())
+	})
+
+	t.Run("Test Roll", func(t *testing.T) {
+		rollsum := NewRollsum(14)
+		rollsum.Write([]byte("This is a test"))
+		rollsum.Roll('T', '!')
+		assert.Equal(t, uint32(826672756), rollsum.Sum32())
+		assert.Equal(t, []byte("his is a test!"), rollsum.Window())
+	})
+
+	t.Run("Test Reset", func(t *testing.T) {
+		rollsum := NewRollsum(14)
+		rollsum.RollIn('a')
+		rollsum.Reset()
+		assert.Empty(t, rollsum.Window())
+
+		for _, c := range []byte("This is a test") {
+			rollsum.RollIn(c)
+		}
+		assert.Equal(t, uint32(823920295), rollsum.Sum32())
+	})
+}
@@ -0,0 +1,82 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"fmt"
+	gohash "hash"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/md4"
+)
+
+// Cryptographic hash used to confirm that a chunk matched by its weak hash is really the same chunk.
+type StrongHash uint8
+
+const (
+	BLAKE2b StrongHash = iota + 1
+	SHA256
+	// Only meant for compatibility with librsync, since MD4 collisions are easy to craft
+	MD4
+)
+
+var ErrUnknownStrongHash = fmt.Errorf("unknown strong hash")
+
+func ParseStrongHash(name string) (StrongHash, error) {
+	switch strings.ToLower(name) {
+	case "blake2b":
+		return BLAKE2b, nil
+	case "sha256":
+		return SHA256, nil
+	case "md4":
+		return MD4, nil
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnknownStrongHash, name)
+	}
+}
+
+func (s StrongHash) New() gohash.Hash {
+	switch s {
+	case BLAKE2b:
+		// Cannot fail since no key is used
+		h, _ := blake2b.New256(nil)
+		return h
+	case SHA256:
+		return sha256.New()
+	case MD4:
+		return md4.New()
+	default:
+		panic(fmt.Sprintf("%v: %d", ErrUnknownStrongHash, s))
+	}
+}
+
+// Length of the full digest in bytes.
+func (s StrongHash) Size() int {
+	switch s {
+	case BLAKE2b:
+		return blake2b.Size256
+	case SHA256:
+		return sha256.Size
+	case MD4:
+		return md4.Size
+	default:
+		return 0
+	}
+}
+
+func (s StrongHash) Valid() bool {
+	return s.Size() > 0
+}
+
+func (s StrongHash) String() string {
+	switch s {
+	case BLAKE2b:
+		return "blake2b"
+	case SHA256:
+		return "sha256"
+	case MD4:
+		return "md4"
+	default:
+		return fmt.Sprintf("StrongHash(%d)", uint8(s))
+	}
+}
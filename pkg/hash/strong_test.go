@@ -0,0 +1,55 @@
+package hash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStrongHash(t *testing.T) {
+	testCases := []struct {
+		name         string
+		input        string
+		expectedHash StrongHash
+		expectedErr  error
+	}{
+		{
+			name:         "BLAKE2b",
+			input:        "blake2b",
+			expectedHash: BLAKE2b,
+		},
+		{
+			name:         "SHA256",
+			input:        "SHA256",
+			expectedHash: SHA256,
+		},
+		{
+			name:         "MD4",
+			input:        "md4",
+			expectedHash: MD4,
+		},
+		{
+			name:        "Unknown",
+			input:       "md5",
+			expectedErr: ErrUnknownStrongHash,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			strongHash, err := ParseStrongHash(tc.input)
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.Equal(t, tc.expectedHash, strongHash)
+		})
+	}
+}
+
+func TestStrongHashSize(t *testing.T) {
+	for _, strongHash := range []StrongHash{BLAKE2b, SHA256, MD4} {
+		h := strongHash.New()
+		h.Write([]byte("This is a test"))
+		assert.Len(t, h.Sum(nil), strongHash.Size())
+		assert.True(t, strongHash.Valid())
+	}
+	assert.False(t, StrongHash(0).Valid())
+}
@@ -0,0 +1,69 @@
+package hash
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rolling hash used to find chunks of the original file at any offset of the updated file.
+type WeakHash uint8
+
+const (
+	Adler32 WeakHash = iota + 1
+	// Only meant for compatibility with rsync and librsync
+	Rollsum
+	RabinKarp
+	Buzhash
+)
+
+var ErrUnknownWeakHash = fmt.Errorf("unknown weak hash")
+
+func ParseWeakHash(name string) (WeakHash, error) {
+	switch strings.ToLower(name) {
+	case "adler32":
+		return Adler32, nil
+	case "rollsum":
+		return Rollsum, nil
+	case "rabinkarp":
+		return RabinKarp, nil
+	case "buzhash":
+		return Buzhash, nil
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnknownWeakHash, name)
+	}
+}
+
+// Creates the rolling checksum over a window of windowSize bytes.
+func (w WeakHash) New(windowSize int) Rolling {
+	switch w {
+	case Adler32:
+		return NewAdler32(windowSize)
+	case Rollsum:
+		return NewRollsum(windowSize)
+	case RabinKarp:
+		return NewRabinKarp(windowSize)
+	case Buzhash:
+		return NewBuzhash(windowSize)
+	default:
+		panic(fmt.Sprintf("%v: %d", ErrUnknownWeakHash, w))
+	}
+}
+
+func (w WeakHash) Valid() bool {
+	return w >= Adler32 && w <= Buzhash
+}
+
+func (w WeakHash) String() string {
+	switch w {
+	case Adler32:
+		return "adler32"
+	case Rollsum:
+		return "rollsum"
+	case RabinKarp:
+		return "rabinkarp"
+	case Buzhash:
+		return "buzhash"
+	default:
+		return fmt.Sprintf("WeakHash(%d)", uint8(w))
+	}
+}
@@ -0,0 +1,58 @@
+package hash
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWeakHash(t *testing.T) {
+	testCases := []struct {
+		name         string
+		input        string
+		expectedHash WeakHash
+		expectedErr  error
+	}{
+		{
+			name:         "Adler32",
+			input:        "adler32",
+			expectedHash: Adler32,
+		},
+		{
+			name:         "Rollsum",
+			input:        "rollsum",
+			expectedHash: Rollsum,
+		},
+		{
+			name:         "RabinKarp",
+			input:        "RabinKarp",
+			expectedHash: RabinKarp,
+		},
+		{
+			name:         "Buzhash",
+			input:        "buzhash",
+			expectedHash: Buzhash,
+		},
+		{
+			name:        "Unknown",
+			input:       "crc32",
+			expectedErr: ErrUnknownWeakHash,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			weakHash, err := ParseWeakHash(tc.input)
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.Equal(t, tc.expectedHash, weakHash)
+		})
+	}
+}
+
+func TestWeakHashValid(t *testing.T) {
+	for _, weakHash := range weakHashes {
+		assert.True(t, weakHash.Valid())
+	}
+	assert.False(t, WeakHash(0).Valid())
+	assert.False(t, WeakHash(5).Valid())
+}
@@ -0,0 +1,79 @@
+package hash
+
+/*
+Window of a rolling checksum kept in a ring buffer, so that sliding it never allocates. Every byte is stored
+twice, once in each half of the buffer, so the bytes of the window are always contiguous and can be returned
+as a single slice without copying them.
+*/
+type ring struct {
+	buffer []byte
+	start  int
+	length int
+}
+
+func newRing(size int) ring {
+	return ring{buffer: make([]byte, 2*max(size, 1))}
+}
+
+func (r *ring) size() int {
+	return len(r.buffer) / 2
+}
+
+// Appends c to the end of the window. The buffer only grows when more bytes are written than the window size it was created with.
+func (r *ring) push(c byte) {
+	if r.length == r.size() {
+		r.grow()
+	}
+	i := r.start + r.length
+	if i >= r.size() {
+		i -= r.size()
+	}
+	r.buffer[i] = c
+	r.buffer[i+r.size()] = c
+	r.length++
+}
+
+// Removes the first byte of the window and returns it.
+func (r *ring) pop() byte {
+	c := r.buffer[r.start]
+	r.start++
+	if r.start == r.size() {
+		r.start = 0
+	}
+	r.length--
+	return c
+}
+
+// Removes the first byte of the window and appends c to its end, keeping the length of the window.
+func (r *ring) roll(c byte) byte {
+	out := r.buffer[r.start]
+	i := r.start + r.length
+	if i >= r.size() {
+		i -= r.size()
+	}
+	r.buffer[i] = c
+	r.buffer[i+r.size()] = c
+	r.start++
+	if r.start == r.size() {
+		r.start = 0
+	}
+	return out
+}
+
+func (r *ring) bytes() []byte {
+	return r.buffer[r.start : r.start+r.length]
+}
+
+func (r *ring) reset() {
+	r.start = 0
+	r.length = 0
+}
+
+func (r *ring) grow() {
+	window := r.bytes()
+	buffer := make([]byte, 2*len(r.buffer))
+	copy(buffer, window)
+	copy(buffer[len(r.buffer):], window)
+	r.buffer = buffer
+	r.start = 0
+}
@@ -1,8 +0,0 @@
-package utils
-
-import "reflect"
-
-func Clear(v interface{}) {
-	p := reflect.ValueOf(v).Elem()
-	p.Set(reflect.Zero(p.Type()))
-}